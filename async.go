@@ -0,0 +1,216 @@
+package glog
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// What an async queue does with an entry when it is full.
+const (
+	overflowBlock      = iota // wait for room
+	overflowDropNewest        // drop the entry
+	overflowDropOldest        // drop the oldest queued entry to make room
+	overflowDropBelow         // drop it if it is below dropLevel, wait otherwise
+)
+
+// asyncQueue hands encoded entries from the logging goroutines to a
+// writer goroutine, which hands write errors to onError. Entries of
+// ErrorLevel and above take the urgent lane, which is drained first and
+// never drops anything. Once closed, entries are written by the logging
+// goroutines themselves.
+type asyncQueue struct {
+	queue     chan *buffer
+	urgent    chan *buffer
+	overflow  int
+	dropLevel int
+	report    time.Duration // how often dropped entries are reported
+
+	flush  chan chan struct{}
+	stop   chan struct{}
+	done   chan struct{}
+	mu     sync.RWMutex // read locked while queueing, so close waits for it
+	closed bool
+
+	reported int64 // dropped count of the last report, writer goroutine only
+}
+
+func (l *Logger) setAsync(options map[string]interface{}) {
+	q := &asyncQueue{
+		flush: make(chan chan struct{}),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	size, _ := options["queueSize"].(int)
+	if size <= 0 {
+		size = 1024
+	}
+	q.queue = make(chan *buffer, size)
+	q.urgent = make(chan *buffer, size)
+
+	if s, ok := options["overflow"].(string); ok {
+		switch strings.ToLower(strings.TrimSpace(s)) {
+		case "block":
+			q.overflow = overflowBlock
+		case "dropnewest":
+			q.overflow = overflowDropNewest
+		case "dropoldest":
+			q.overflow = overflowDropOldest
+		case "dropbelow":
+			q.overflow = overflowDropBelow
+		default:
+			log.Printf("overflow [%s] invalid, must be block, dropNewest, dropOldest or dropBelow, set to block\n", s)
+		}
+	}
+	if lv, ok := options["dropLevel"].(int); ok {
+		q.dropLevel = lv
+	} else {
+		q.dropLevel = WarnLevel
+	}
+	if q.report, _ = options["dropReportInterval"].(time.Duration); q.report <= 0 {
+		q.report = 10 * time.Second
+	}
+
+	l.async = q
+	go l.asyncRoutine(q)
+}
+
+// enqueue queues b, or drops it as the overflow policy says. It returns
+// false once the queue is closed, b is then the caller's to write.
+func (q *asyncQueue) enqueue(l *Logger, b *buffer) bool {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return false
+	}
+	if b.e.Level >= ErrorLevel {
+		q.urgent <- b
+		return true
+	}
+	select {
+	case q.queue <- b:
+		return true
+	default:
+	}
+
+	switch q.overflow {
+	case overflowDropBelow:
+		if b.e.Level >= q.dropLevel {
+			q.queue <- b
+			return true
+		}
+		fallthrough
+	case overflowDropNewest:
+		atomic.AddInt64(&l.dropped, 1)
+		putBuffer(b)
+	case overflowDropOldest:
+		for {
+			select {
+			case q.queue <- b:
+				return true
+			default:
+			}
+			select {
+			case old := <-q.queue:
+				atomic.AddInt64(&l.dropped, 1)
+				putBuffer(old)
+			default:
+			}
+		}
+	default:
+		q.queue <- b
+	}
+	return true
+}
+
+// drain returns once the entries queued before the call are written.
+func (q *asyncQueue) drain() {
+	done := make(chan struct{})
+	select {
+	case q.flush <- done:
+		<-done
+	case <-q.done:
+	}
+}
+
+// close writes what is queued and ends the writer goroutine. Entries
+// being queued are waited for, the writer goroutine still takes them.
+func (q *asyncQueue) close() {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.stop)
+	}
+	q.mu.Unlock()
+	<-q.done
+}
+
+func (l *Logger) asyncRoutine(q *asyncQueue) {
+	tk := time.NewTicker(q.report)
+	defer tk.Stop()
+	for {
+		// the urgent lane first
+		select {
+		case b := <-q.urgent:
+			l.write(b)
+			continue
+		default:
+		}
+
+		select {
+		case b := <-q.urgent:
+			l.write(b)
+		case b := <-q.queue:
+			l.write(b)
+		case done := <-q.flush:
+			l.drainQueue(q)
+			close(done)
+		case <-tk.C:
+			l.reportDropped(q)
+		case <-q.stop:
+			l.drainQueue(q)
+			l.reportDropped(q)
+			close(q.done)
+			return
+		}
+	}
+}
+
+func (l *Logger) drainQueue(q *asyncQueue) {
+	for {
+		select {
+		case b := <-q.urgent:
+			l.write(b)
+		case b := <-q.queue:
+			l.write(b)
+		default:
+			return
+		}
+	}
+}
+
+// reportDropped writes a warning with the number of entries dropped since
+// the last report, if there are any.
+func (l *Logger) reportDropped(q *asyncQueue) {
+	dropped := atomic.LoadInt64(&l.dropped)
+	n := dropped - q.reported
+	if n == 0 {
+		return
+	}
+	q.reported = dropped
+
+	b := getBuffer()
+	b.e.Time = time.Now()
+	b.e.Level = WarnLevel
+	b.e.Prefix = l.prefixes()[WarnLevel]
+	if l.Flags()&Lsequence != 0 {
+		b.e.Seq = atomic.AddUint64(&sequence, 1)
+	}
+	b.msg = fmt.Appendf(b.msg, "glog: %d entries dropped", n)
+	b.e.Message = b.message()
+	b.out = l.encoder(WarnLevel).Encode(b.out, l.Flags()&^(Lshortfile|Llongfile), &b.e)
+	l.write(b)
+}
@@ -0,0 +1,172 @@
+package glog
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// gateWriter blocks its first Write until the gate opens.
+type gateWriter struct {
+	bytes.Buffer
+	entered chan struct{}
+	gate    chan struct{}
+}
+
+func (w *gateWriter) Write(p []byte) (int, error) {
+	if w.entered != nil {
+		close(w.entered)
+		w.entered = nil
+		<-w.gate
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestAsync(t *testing.T) {
+	var w bytes.Buffer
+	l := newTestLogger(&w, 0)
+	l.setOptions(map[string]interface{}{"async": true, "queueSize": 4})
+	var want strings.Builder
+	for i := 0; i < 100; i++ {
+		l.Info("%d", i)
+		want.WriteString("INFO " + strconv.Itoa(i) + "\n")
+	}
+	l.Flush()
+	if w.String() != want.String() {
+		t.Errorf("got %q", w.String())
+	}
+	l.Close()
+}
+
+func TestAsyncOverflow(t *testing.T) {
+	tests := []struct {
+		overflow string
+		want     string
+	}{
+		{"dropNewest", "INFO a\nERROR e\nINFO b\nWARN glog: 2 entries dropped\n"},
+		{"dropOldest", "INFO a\nERROR e\nINFO d\nWARN glog: 2 entries dropped\n"},
+		{"dropBelow", "INFO a\nERROR e\nINFO b\nWARN glog: 2 entries dropped\n"},
+	}
+	for _, tt := range tests {
+		w := &gateWriter{entered: make(chan struct{}), gate: make(chan struct{})}
+		entered := w.entered
+		l := newTestLogger(w, 0)
+		l.setOptions(map[string]interface{}{"async": true, "queueSize": 1, "overflow": tt.overflow})
+
+		l.Info("a")
+		<-entered // the writer goroutine holds a
+		l.Info("b")
+		l.Info("c")
+		l.Info("d")
+		l.Error("e")
+		close(w.gate)
+		l.Close()
+		if st := l.Stats(); st.Dropped != 2 {
+			t.Errorf("%s: %d dropped, want 2", tt.overflow, st.Dropped)
+		}
+		if got := w.String(); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.overflow, got, tt.want)
+		}
+	}
+}
+
+func TestAsyncAfterClose(t *testing.T) {
+	var w bytes.Buffer
+	l := newTestLogger(&w, 0)
+	l.setOptions(map[string]interface{}{"async": true, "queueSize": 1})
+	l.Close()
+
+	// with no writer goroutine left, the entries are written directly
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 3; i++ {
+			l.Info("i")
+			l.Error("e")
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("logging after Close blocked")
+	}
+	if got := w.String(); got != strings.Repeat("INFO i\nERROR e\n", 3) {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestAsyncCloseRace(t *testing.T) {
+	// entries logged while closing are written, never left in the queue
+	for run := 0; run < 10; run++ {
+		var w bytes.Buffer
+		l := newTestLogger(&w, 0)
+		l.setOptions(map[string]interface{}{"async": true})
+		var n int64
+		stop := make(chan struct{})
+		var wg sync.WaitGroup
+		for g := 0; g < 4; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+					}
+					l.Info("i")
+					atomic.AddInt64(&n, 1)
+				}
+			}()
+		}
+		time.Sleep(time.Millisecond)
+		l.Close()
+		close(stop)
+		wg.Wait()
+		if got := int64(strings.Count(w.String(), "\n")); got != n {
+			t.Fatalf("got %d entries, want %d", got, n)
+		}
+	}
+}
+
+func TestPanicFlushes(t *testing.T) {
+	for _, options := range []map[string]interface{}{
+		{"async": true},
+		{"buffered": true, "flushInterval": time.Hour, "flushLevel": PanicLevel + 1},
+	} {
+		var w bytes.Buffer
+		l := newTestLogger(&w, 0)
+		l.setOptions(options)
+		func() {
+			defer func() { recover() }()
+			l.Panic("boom")
+		}()
+		if got := w.String(); got != "PANIC boom\n" {
+			t.Errorf("%v: got %q", options, got)
+		}
+		l.Close()
+	}
+}
+
+func TestPanicArgs(t *testing.T) {
+	var w bytes.Buffer
+	l := newTestLogger(&w, 0)
+	l.setOptions(map[string]interface{}{"maxFieldBytes": 100})
+	u := testUser{Name: "bob", Password: "hunter2", Token: "abc"}
+	var v interface{}
+	func() {
+		defer func() { v = recover() }()
+		l.Panic("%+v %s", u, strings.Repeat("x", 200))
+	}()
+	s, _ := v.(string)
+	for _, got := range []string{w.String(), s} {
+		if !strings.Contains(got, "{Name=bob token=[REDACTED] ") || strings.Contains(got, "hunter2") ||
+			strings.Contains(got, strings.Repeat("x", 101)) {
+			t.Errorf("got %q", got)
+		}
+	}
+}
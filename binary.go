@@ -0,0 +1,124 @@
+package glog
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// Version and field type codes of the binary format, see package binlog.
+const (
+	binaryVersion = 1
+
+	binString   = 1
+	binInt64    = 2
+	binFloat64  = 3
+	binBool     = 4
+	binDuration = 5
+	binTime     = 6
+	binJSON     = 7
+)
+
+// binaryEncoder writes compact length-prefixed records instead of text
+// lines. Package binlog reads them back and converts them to text or JSON.
+type binaryEncoder struct {
+	redact  *redactor
+	static  []byte // the encoded static fields
+	nstatic int
+}
+
+func (be binaryEncoder) Encode(buf []byte, flag int, e *Entry) []byte {
+	tmp := getBuffer()
+	b := append(tmp.out, binaryVersion)
+	b = binary.AppendVarint(b, e.Time.UnixNano())
+	b = append(b, byte(e.Level))
+	if e.File != "" {
+		b = appendBinaryString(b, callerFile(flag, e.File))
+		b = binary.AppendUvarint(b, uint64(e.Line))
+	} else {
+		b = appendBinaryString(b, "")
+	}
+	msg := e.Message
+	if len(msg) > 0 && msg[len(msg)-1] == '\n' {
+		msg = msg[:len(msg)-1]
+	}
+	b = appendBinaryString(b, msg)
+
+	// the instance ID, sequence number and static fields go first as
+	// ordinary fields
+	n := be.nstatic + len(e.Fields)
+	if flag&Linstance != 0 {
+		n++
+	}
+	if flag&Lsequence != 0 {
+		n++
+	}
+	b = binary.AppendUvarint(b, uint64(n))
+	if flag&Linstance != 0 {
+		b = appendBinaryString(b, "instance")
+		b = append(b, binString)
+		b = appendBinaryString(b, instanceID)
+	}
+	if flag&Lsequence != 0 {
+		b = appendBinaryString(b, "seq")
+		b = append(b, binInt64)
+		b = binary.AppendVarint(b, int64(e.Seq))
+	}
+	b = append(b, be.static...)
+	for i := range e.Fields {
+		b = be.appendField(b, &e.Fields[i])
+	}
+
+	buf = binary.AppendUvarint(buf, uint64(len(b)))
+	buf = append(buf, b...)
+	tmp.out = b
+	putBuffer(tmp)
+	return buf
+}
+
+func (be binaryEncoder) appendField(b []byte, f *Field) []byte {
+	b = appendBinaryString(b, f.Key)
+	switch f.typ {
+	case stringType:
+		b = append(b, binString)
+		return appendBinaryString(b, f.str)
+	case int64Type:
+		b = append(b, binInt64)
+		return binary.AppendVarint(b, f.num)
+	case float64Type:
+		b = append(b, binFloat64)
+		return binary.LittleEndian.AppendUint64(b, uint64(f.num))
+	case boolType:
+		b = append(b, binBool, byte(f.num))
+		return b
+	case durationType:
+		b = append(b, binDuration)
+		return binary.AppendVarint(b, f.num)
+	case timeType:
+		t := f.time()
+		if y := t.Year(); y >= 1678 && y <= 2261 {
+			b = append(b, binTime)
+			return binary.AppendVarint(b, t.UnixNano())
+		}
+		b = append(b, binString)
+		return appendBinaryString(b, t.Format(time.RFC3339Nano))
+	case errorType:
+		b = append(b, binString)
+		return appendBinaryString(b, errorText(f.iface.(error)))
+	}
+
+	// objects, arrays and anything else are stored as JSON
+	b = append(b, binJSON)
+	tmp := getBuffer()
+	o := jsonObject{buf: tmp.msg, redact: be.redact, array: true}
+	o.add(*f)
+	b = binary.AppendUvarint(b, uint64(len(o.buf)))
+	b = append(b, o.buf...)
+	tmp.msg = o.buf
+	putBuffer(tmp)
+	return b
+}
+
+func appendBinaryString(b []byte, s string) []byte {
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
@@ -0,0 +1,80 @@
+package glog
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smtc/glog/binlog"
+)
+
+func TestBinaryRoundTrip(t *testing.T) {
+	e := &Entry{
+		Level:   WarnLevel,
+		Prefix:  "WARN",
+		Time:    time.Date(2015, 9, 30, 8, 0, 0, 0, time.UTC),
+		File:    "/src/app/d.go",
+		Line:    23,
+		Message: "login\n",
+		Fields:  testFields(),
+	}
+	enc := binaryEncoder{}
+	buf := enc.Encode(nil, Lshortfile, e)
+	buf = enc.Encode(buf, 0, &Entry{Level: InfoLevel, Time: e.Time, Message: "second"})
+
+	r := binlog.NewReader(bytes.NewReader(buf))
+	rec, err := r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rec.Time.Equal(e.Time) || rec.Level != WarnLevel || rec.File != "d.go" || rec.Line != 23 ||
+		rec.Message != "login" || len(rec.Fields) != len(e.Fields) {
+		t.Fatalf("got %+v", rec)
+	}
+	rec.Time = rec.Time.UTC()
+	if got, want := string(binlog.AppendJSON(nil, rec)),
+		`{"time":"2015-09-30T08:00:00Z","level":"WARN","caller":"d.go:23","msg":"login","user":"bob smith","id":42,`+
+			`"big":-1099511627776,"ratio":0.5,"ok":true,"took":"1.5s","at":"2015-09-30T08:00:00Z",`+
+			`"error":"no \"such\" file","tags":["a","b"]}`+"\n"; got != want {
+		t.Errorf("json:\ngot  %s\nwant %s", got, want)
+	}
+	if got := string(binlog.AppendText(nil, rec)); !strings.HasPrefix(got, "2015/09/30 08:00:00.000000 d.go:23: WARN login user=\"bob smith\" id=42") {
+		t.Errorf("text: got %s", got)
+	}
+
+	if rec, err = r.Next(); err != nil || rec.Message != "second" || rec.File != "" || len(rec.Fields) != 0 {
+		t.Errorf("second record: %+v, %v", rec, err)
+	}
+	if _, err = r.Next(); err != io.EOF {
+		t.Errorf("at end: %v, want EOF", err)
+	}
+
+	r = binlog.NewReader(bytes.NewReader(buf[:len(buf)-3]))
+	r.Next()
+	if _, err = r.Next(); err != io.ErrUnexpectedEOF {
+		t.Errorf("truncated: %v, want ErrUnexpectedEOF", err)
+	}
+	if _, err = binlog.Decode(buf[1:10]); err != binlog.ErrCorrupt {
+		t.Errorf("garbage: %v, want ErrCorrupt", err)
+	}
+}
+
+func TestLevelEncoding(t *testing.T) {
+	var w bytes.Buffer
+	l := newTestLogger(&w, 0)
+	l.setOptions(map[string]interface{}{
+		"levelEncoding": map[int]string{ErrorLevel: "binary"},
+	})
+	l.Info("text")
+	n := w.Len()
+	l.Error("bin")
+	if got := w.String()[:n]; got != "INFO text\n" {
+		t.Errorf("info: got %q", got)
+	}
+	rec, err := binlog.NewReader(bytes.NewReader(w.Bytes()[n:])).Next()
+	if err != nil || rec.Level != ErrorLevel || rec.Message != "bin" {
+		t.Errorf("error: got %+v, %v", rec, err)
+	}
+}
@@ -0,0 +1,297 @@
+// Package binlog reads the compact binary log files glog writes with the
+// "binary" encoding, and converts their records to glog's text or JSON
+// format.
+//
+// A file is a sequence of records, each a uvarint length followed by that
+// many bytes of body. Integers are varints as in encoding/binary, strings
+// a uvarint length followed by the bytes. The body holds:
+//
+//	version  byte, 1
+//	time     varint, nanoseconds since the Unix epoch
+//	level    byte, 0 (DEBUG) to 5 (PANIC)
+//	file     string, the caller, empty if it was not recorded
+//	line     uvarint, only present if file is not empty
+//	message  string
+//	count    uvarint, the number of fields, starting with "instance" and
+//	         "seq" if glog's Linstance and Lsequence flags are set, each being
+//	  key    string
+//	  type   byte, then the value:
+//	         1 string, 2 int64 (varint), 3 float64 (8 bytes little endian),
+//	         4 bool (byte), 5 duration (varint nanoseconds),
+//	         6 time (varint nanoseconds since the epoch), 7 JSON (string)
+package binlog
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+const version = 1
+
+// Field type codes.
+const (
+	typeString   = 1
+	typeInt64    = 2
+	typeFloat64  = 3
+	typeBool     = 4
+	typeDuration = 5
+	typeTime     = 6
+	typeJSON     = 7
+)
+
+// maxRecord guards against allocating for garbage length prefixes.
+const maxRecord = 64 << 20
+
+var levelNames = []string{"DEBUG", "INFO", "WARN", "ERROR", "FATAL", "PANIC"}
+
+// ErrCorrupt is returned for records that cannot be decoded.
+var ErrCorrupt = errors.New("binlog: corrupt record")
+
+// A Record is one decoded log entry.
+type Record struct {
+	Time    time.Time
+	Level   int
+	File    string
+	Line    int
+	Message string
+	Fields  []Field
+}
+
+// A Field is a key and its value: a string, int64, float64, bool,
+// time.Duration, time.Time or json.RawMessage.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// LevelName returns the name of a level, as used for glog's level files.
+func LevelName(lv int) string {
+	if lv >= 0 && lv < len(levelNames) {
+		return levelNames[lv]
+	}
+	return strconv.Itoa(lv)
+}
+
+// A Reader reads records from a binary log file.
+type Reader struct {
+	r   *bufio.Reader
+	buf []byte
+}
+
+// NewReader returns a Reader reading from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Next returns the next record. At the end of the input it returns
+// io.EOF, for a record cut short io.ErrUnexpectedEOF.
+func (r *Reader) Next() (*Record, error) {
+	n, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, io.ErrUnexpectedEOF
+	}
+	if n > maxRecord {
+		return nil, ErrCorrupt
+	}
+	if uint64(cap(r.buf)) < n {
+		r.buf = make([]byte, n)
+	}
+	r.buf = r.buf[:n]
+	if _, err = io.ReadFull(r.r, r.buf); err != nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return Decode(r.buf)
+}
+
+// Decode decodes the body of one record.
+func Decode(body []byte) (*Record, error) {
+	d := decoder{b: body}
+	if d.byte() != version {
+		return nil, ErrCorrupt
+	}
+	rec := &Record{}
+	rec.Time = time.Unix(0, d.varint())
+	rec.Level = int(d.byte())
+	if rec.File = d.string(); rec.File != "" {
+		rec.Line = int(d.uvarint())
+	}
+	rec.Message = d.string()
+
+	n := d.uvarint()
+	if n > uint64(len(d.b)) {
+		return nil, ErrCorrupt
+	}
+	rec.Fields = make([]Field, 0, n)
+	for i := uint64(0); i < n && d.err == nil; i++ {
+		f := Field{Key: d.string()}
+		switch d.byte() {
+		case typeString:
+			f.Value = d.string()
+		case typeInt64:
+			f.Value = d.varint()
+		case typeFloat64:
+			f.Value = math.Float64frombits(binary.LittleEndian.Uint64(d.bytes(8)))
+		case typeBool:
+			f.Value = d.byte() != 0
+		case typeDuration:
+			f.Value = time.Duration(d.varint())
+		case typeTime:
+			f.Value = time.Unix(0, d.varint())
+		case typeJSON:
+			f.Value = json.RawMessage(d.string())
+		default:
+			d.err = ErrCorrupt
+		}
+		rec.Fields = append(rec.Fields, f)
+	}
+	if d.err != nil || len(d.b) != 0 {
+		return nil, ErrCorrupt
+	}
+	return rec, nil
+}
+
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil || n > len(d.b) {
+		d.err = ErrCorrupt
+		return make([]byte, n)
+	}
+	b := d.b[:n]
+	d.b = d.b[n:]
+	return b
+}
+
+func (d *decoder) byte() byte {
+	return d.bytes(1)[0]
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.b)
+	if n <= 0 {
+		d.err = ErrCorrupt
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.b)
+	if n <= 0 {
+		d.err = ErrCorrupt
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) string() string {
+	n := d.uvarint()
+	if n > uint64(len(d.b)) {
+		d.err = ErrCorrupt
+		return ""
+	}
+	return string(d.bytes(int(n)))
+}
+
+// AppendText appends rec as a line of glog's text format, with date,
+// microsecond time and the caller if there is one.
+func AppendText(dst []byte, rec *Record) []byte {
+	dst = rec.Time.AppendFormat(dst, "2006/01/02 15:04:05.000000 ")
+	if rec.File != "" {
+		dst = fmt.Appendf(dst, "%s:%d: ", rec.File, rec.Line)
+	}
+	dst = append(dst, LevelName(rec.Level)...)
+	dst = append(dst, ' ')
+	dst = append(dst, rec.Message...)
+	for _, f := range rec.Fields {
+		dst = append(dst, ' ')
+		dst = append(dst, f.Key...)
+		dst = append(dst, '=')
+		dst = appendTextValue(dst, f.Value)
+	}
+	return append(dst, '\n')
+}
+
+func appendTextValue(dst []byte, v interface{}) []byte {
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = v
+	case time.Time:
+		return v.AppendFormat(dst, time.RFC3339Nano)
+	case json.RawMessage:
+		s = string(v)
+	default:
+		return fmt.Append(dst, v)
+	}
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c <= ' ' || c == '=' || c == '"' || c >= 0x7f {
+			return strconv.AppendQuote(dst, s)
+		}
+	}
+	if s == "" {
+		return append(dst, `""`...)
+	}
+	return append(dst, s...)
+}
+
+// AppendJSON appends rec as a line of glog's JSON format.
+func AppendJSON(dst []byte, rec *Record) []byte {
+	dst = append(dst, `{"time":`...)
+	dst = appendJSON(dst, rec.Time.Format(time.RFC3339Nano))
+	dst = append(dst, `,"level":`...)
+	dst = appendJSON(dst, LevelName(rec.Level))
+	if rec.File != "" {
+		dst = append(dst, `,"caller":`...)
+		dst = appendJSON(dst, rec.File+":"+strconv.Itoa(rec.Line))
+	}
+	dst = append(dst, `,"msg":`...)
+	dst = appendJSON(dst, rec.Message)
+	for _, f := range rec.Fields {
+		dst = append(dst, ',')
+		dst = appendJSON(dst, f.Key)
+		dst = append(dst, ':')
+		switch v := f.Value.(type) {
+		case time.Duration:
+			dst = appendJSON(dst, v.String())
+		case float64:
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				dst = appendJSON(dst, strconv.FormatFloat(v, 'g', -1, 64))
+				continue
+			}
+			dst = appendJSON(dst, v)
+		default:
+			dst = appendJSON(dst, v)
+		}
+	}
+	return append(dst, '}', '\n')
+}
+
+func appendJSON(dst []byte, v interface{}) []byte {
+	b, err := json.Marshal(v)
+	if err != nil {
+		b, _ = json.Marshal(fmt.Sprint(v))
+	}
+	return append(dst, b...)
+}
@@ -0,0 +1,66 @@
+package glog
+
+import (
+	"sync"
+	"unsafe"
+)
+
+// buffers larger than this are dropped instead of going back to the pool,
+// so that one huge entry does not pin its memory forever.
+const maxPooledBuffer = 64 << 10
+
+// buffer is the per-call scratch space of a logging event: the entry, the
+// formatted message and the encoded output.
+type buffer struct {
+	e      Entry
+	msg    []byte
+	out    []byte
+	fields []Field // the entry fields
+	args   int     // the last args fields are the arguments of a template
+
+	truncated bool // the message was cut by a size limit
+}
+
+var bufPool = sync.Pool{
+	New: func() interface{} {
+		return &buffer{
+			msg: make([]byte, 0, 256),
+			out: make([]byte, 0, 512),
+		}
+	},
+}
+
+func getBuffer() *buffer {
+	return bufPool.Get().(*buffer)
+}
+
+func putBuffer(b *buffer) {
+	if cap(b.msg) > maxPooledBuffer || cap(b.out) > maxPooledBuffer {
+		return
+	}
+	b.e = Entry{}
+	for i := range b.fields {
+		b.fields[i] = Field{}
+	}
+	b.fields = b.fields[:0]
+	b.args = 0
+	b.truncated = false
+	b.msg = b.msg[:0]
+	b.out = b.out[:0]
+	bufPool.Put(b)
+}
+
+// message returns the formatted message without copying it. The string
+// is only valid until b goes back to the pool.
+func (b *buffer) message() string {
+	if len(b.msg) == 0 {
+		return ""
+	}
+	return unsafe.String(&b.msg[0], len(b.msg))
+}
+
+// swap makes the text built in b.out the message of the entry.
+func (b *buffer) swap() {
+	b.msg, b.out = b.out, b.msg[:0]
+	b.e.Message = b.message()
+}
@@ -0,0 +1,76 @@
+// Command glogcat converts binary glog files to text or JSON lines.
+//
+//	glogcat [-format text|json] [file ...]
+//
+// With no files it reads standard input.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/smtc/glog/binlog"
+)
+
+func main() {
+	format := flag.String("format", "text", "output format, text or json")
+	flag.Parse()
+
+	var conv func([]byte, *binlog.Record) []byte
+	switch *format {
+	case "text":
+		conv = binlog.AppendText
+	case "json":
+		conv = binlog.AppendJSON
+	default:
+		fmt.Fprintf(os.Stderr, "glogcat: unknown format %q\n", *format)
+		os.Exit(2)
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+
+	status := 0
+	if flag.NArg() == 0 {
+		if err := cat(w, os.Stdin, conv); err != nil {
+			fmt.Fprintf(os.Stderr, "glogcat: %v\n", err)
+			status = 1
+		}
+	}
+	for _, name := range flag.Args() {
+		f, err := os.Open(name)
+		if err == nil {
+			err = cat(w, f, conv)
+			f.Close()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "glogcat: %s: %v\n", name, err)
+			status = 1
+		}
+	}
+	if status != 0 {
+		w.Flush()
+		os.Exit(status)
+	}
+}
+
+func cat(w *bufio.Writer, r io.Reader, conv func([]byte, *binlog.Record) []byte) error {
+	br := binlog.NewReader(r)
+	var buf []byte
+	for {
+		rec, err := br.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		buf = conv(buf[:0], rec)
+		if _, err = w.Write(buf); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package glog
+
+import (
+	"io"
+	"log"
+	"os"
+)
+
+// noClose keeps Close from closing standard output or error.
+type noClose struct {
+	io.Writer
+}
+
+func (noClose) Close() error { return nil }
+
+// levelColors are the ANSI colors of the level prefixes with "color".
+var levelColors = map[int]string{
+	DebugLevel: "\x1b[90m",
+	InfoLevel:  "\x1b[32m",
+	WarnLevel:  "\x1b[33m",
+	ErrorLevel: "\x1b[31m",
+	FatalLevel: "\x1b[1;35m",
+	PanicLevel: "\x1b[1;35m",
+}
+
+const colorReset = "\x1b[0m"
+
+// createConsoleLogger returns a Logger writing to the terminal, for use
+// as a sink of a tee logger. Unlike the default console it has all the
+// Logger options.
+//
+// options:
+//
+//	flag: int
+//	prefix: map[int]string
+//	output: string, "stderr" (default) or "stdout", or an io.Writer
+//	and the Logger options, see setOptions
+func createConsoleLogger(options map[string]interface{}) *Logger {
+	flag, ok := options["flag"].(int)
+	if !ok {
+		flag = LstdFlags
+	}
+	prefix, ok := options["prefix"].(map[int]string)
+	if !ok {
+		prefix = prefixFn
+	}
+
+	var w io.Writer = os.Stderr
+	switch out := options["output"].(type) {
+	case nil:
+	case string:
+		switch out {
+		case "stderr":
+		case "stdout":
+			w = os.Stdout
+		default:
+			log.Printf("output [%s] invalid, must be stderr or stdout, set to stderr\n", out)
+		}
+	case io.Writer:
+		w = out
+	}
+
+	l := &Logger{flag: int32(flag)}
+	l.prefix.Store(prefix)
+	l.out.out = make(map[int]io.WriteCloser)
+	for i := DebugLevel; i < LevelCount; i++ {
+		l.out.out[i] = noClose{w}
+	}
+	l.setOptions(options)
+	return l
+}
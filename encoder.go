@@ -0,0 +1,183 @@
+package glog
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// An Entry is a single logging event as handed to an Encoder. An entry and
+// the strings it references are only valid during the call it is passed to.
+type Entry struct {
+	Level   int
+	Prefix  string // the prefix the Logger has for Level
+	Time    time.Time
+	Seq     uint64 // only set when Lsequence is requested
+	File    string // only set when Llongfile or Lshortfile is requested
+	Line    int
+	Message string
+	// Template is the format of a leveled call, only set with the
+	// templates option
+	Template string
+	Fields   []Field
+
+	pc uintptr // the caller, set with File
+}
+
+// An Encoder turns entries into bytes. Encode appends the encoded form of e
+// to buf and returns the extended buffer; flag holds the Logger's flags.
+// Encoders are called concurrently.
+type Encoder interface {
+	Encode(buf []byte, flag int, e *Entry) []byte
+}
+
+// How the text encoder writes messages that contain newlines.
+const (
+	multilineRaw    = iota // as they are, only the first line has a header
+	multilinePrefix        // every continuation line gets the header too
+	multilineIndent        // continuation lines start with the marker
+	multilineEscape        // newlines are written as \n, one entry per line
+)
+
+// textEncoder writes lines in the format of the standard log package,
+// with the level prefix in front of the message.
+type textEncoder struct {
+	multiline int
+	marker    string
+	redact    *redactor // for the values nested in object and array fields
+	color     bool      // color the prefix by level, see levelColors
+}
+
+func (te textEncoder) Encode(buf []byte, flag int, e *Entry) []byte {
+	start := len(buf)
+	formatHeader(&buf, flag, e)
+	if te.color {
+		buf = append(buf, levelColors[e.Level]...)
+		buf = append(buf, e.Prefix...)
+		buf = append(buf, colorReset...)
+	} else {
+		buf = append(buf, e.Prefix...)
+	}
+	buf = append(buf, ' ')
+	header := len(buf)
+
+	// the trailing newline ends the entry, it is not a continuation
+	msg := strings.TrimSuffix(e.Message, "\n")
+	for te.multiline != multilineRaw {
+		i := strings.IndexByte(msg, '\n')
+		if i < 0 {
+			break
+		}
+		buf = append(buf, msg[:i]...)
+		msg = msg[i+1:]
+		switch te.multiline {
+		case multilinePrefix:
+			buf = append(buf, '\n')
+			buf = append(buf, buf[start:header]...)
+		case multilineIndent:
+			buf = append(buf, '\n')
+			buf = append(buf, te.marker...)
+		case multilineEscape:
+			buf = append(buf, '\\', 'n')
+		}
+	}
+	buf = append(buf, msg...)
+	buf = appendTextFields(buf, e.Fields, te.redact)
+	if len(e.Message) == 0 && len(e.Fields) == 0 {
+		return buf
+	}
+	return append(buf, '\n')
+}
+
+// jsonEncoder writes one JSON object per line:
+//
+//	{"time":"2009-01-23T01:23:23.123123+08:00","level":"INFO","caller":"d.go:23","msg":"message","key":"value"}
+//
+// caller is only there if the flags ask for it.
+type jsonEncoder struct {
+	redact *redactor
+	static []byte // the encoded static fields, starting with a comma
+}
+
+func (je jsonEncoder) Encode(buf []byte, flag int, e *Entry) []byte {
+	buf = append(buf, `{"time":"`...)
+	buf = e.Time.AppendFormat(buf, time.RFC3339Nano)
+	buf = append(buf, `","level":"`...)
+	buf = append(buf, levelName(e.Level)...)
+	buf = append(buf, '"')
+	if flag&Linstance != 0 {
+		buf = append(buf, `,"instance":"`...)
+		buf = append(buf, instanceID...)
+		buf = append(buf, '"')
+	}
+	if flag&Lsequence != 0 {
+		buf = append(buf, `,"seq":`...)
+		buf = strconv.AppendUint(buf, e.Seq, 10)
+	}
+	if e.File != "" {
+		buf = append(buf, `,"caller":"`...)
+		buf = append(buf, callerFile(flag, e.File)...)
+		buf = append(buf, ':')
+		buf = strconv.AppendInt(buf, int64(e.Line), 10)
+		buf = append(buf, '"')
+	}
+	buf = append(buf, `,"msg":`...)
+	buf = appendJSONString(buf, strings.TrimSuffix(e.Message, "\n"))
+	buf = append(buf, je.static...)
+	o := jsonObject{buf: buf, n: 1, redact: je.redact}
+	for i := range e.Fields {
+		o.add(e.Fields[i])
+	}
+	return append(o.buf, '}', '\n')
+}
+
+// logfmtEncoder writes key=value pairs, one entry per line:
+//
+//	time=2009-01-23T01:23:23.123123+08:00 level=INFO caller=d.go:23 msg="a message" key=value
+type logfmtEncoder struct {
+	redact *redactor
+	static []byte // the encoded static fields
+}
+
+func (le logfmtEncoder) Encode(buf []byte, flag int, e *Entry) []byte {
+	buf = append(buf, "time="...)
+	buf = e.Time.AppendFormat(buf, time.RFC3339Nano)
+	buf = append(buf, " level="...)
+	buf = append(buf, levelName(e.Level)...)
+	if flag&Linstance != 0 {
+		buf = append(buf, " instance="...)
+		buf = append(buf, instanceID...)
+	}
+	if flag&Lsequence != 0 {
+		buf = append(buf, " seq="...)
+		buf = strconv.AppendUint(buf, e.Seq, 10)
+	}
+	if e.File != "" {
+		buf = append(buf, " caller="...)
+		buf = append(buf, callerFile(flag, e.File)...)
+		buf = append(buf, ':')
+		buf = strconv.AppendInt(buf, int64(e.Line), 10)
+	}
+	buf = append(buf, " msg="...)
+	buf = String("", strings.TrimSuffix(e.Message, "\n")).appendQuotedText(buf)
+	buf = append(buf, le.static...)
+	buf = appendTextFields(buf, e.Fields, le.redact)
+	return append(buf, '\n')
+}
+
+// appendTextFields appends " key=value" for each field, see textObject.
+func appendTextFields(buf []byte, fields []Field, r *redactor) []byte {
+	o := textObject{buf: buf, redact: r}
+	for i := range fields {
+		o.add(fields[i])
+	}
+	return o.buf
+}
+
+// levelName returns the name of a level as used for the level files.
+func levelName(lv int) string {
+	if name, ok := prefixFn[lv]; ok {
+		return name
+	}
+	return strconv.Itoa(lv)
+}
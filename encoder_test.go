@@ -0,0 +1,279 @@
+package glog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smtc/glog/binlog"
+)
+
+func testFields() []Field {
+	return []Field{
+		String("user", "bob smith"),
+		Int("id", 42),
+		Int64("big", -1<<40),
+		Float64("ratio", 0.5),
+		Bool("ok", true),
+		Duration("took", 1500*time.Millisecond),
+		Time("at", time.Date(2015, 9, 30, 8, 0, 0, 0, time.UTC)),
+		Err(errors.New(`no "such" file`)),
+		Any("tags", []string{"a", "b"}),
+	}
+}
+
+func TestEncoders(t *testing.T) {
+	tests := []struct {
+		encoding string
+		want     string
+	}{
+		{"text", `INFO login user="bob smith" id=42 big=-1099511627776 ratio=0.5 ok=true took=1.5s ` +
+			`at=2015-09-30T08:00:00Z error="no \"such\" file" tags=[a,b]` + "\n"},
+		{"json", `{"time":"2015-09-30T08:00:00Z","level":"INFO","msg":"login","user":"bob smith","id":42,` +
+			`"big":-1099511627776,"ratio":0.5,"ok":true,"took":"1.5s","at":"2015-09-30T08:00:00Z",` +
+			`"error":"no \"such\" file","tags":["a","b"]}` + "\n"},
+		{"logfmt", `time=2015-09-30T08:00:00Z level=INFO msg=login user="bob smith" id=42 big=-1099511627776 ` +
+			`ratio=0.5 ok=true took=1.5s at=2015-09-30T08:00:00Z error="no \"such\" file" tags=[a,b]` + "\n"},
+	}
+	for _, tt := range tests {
+		l := newTestLogger(io.Discard, 0)
+		l.setOptions(map[string]interface{}{"encoding": tt.encoding})
+		e := &Entry{
+			Level:   InfoLevel,
+			Prefix:  "INFO",
+			Time:    time.Date(2015, 9, 30, 8, 0, 0, 0, time.UTC),
+			Message: "login\n",
+			Fields:  testFields(),
+		}
+		if got := string(l.encoder(InfoLevel).Encode(nil, 0, e)); got != tt.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", tt.encoding, got, tt.want)
+		}
+	}
+}
+
+func TestJSONString(t *testing.T) {
+	got := string(appendJSONString(nil, "a\"\\\n\x01\xff\u2028é"))
+	want := `"a\"\\\n\u0001` + "\ufffd" + `\u2028é"`
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestFieldPolicies(t *testing.T) {
+	var buf bytes.Buffer
+	l := newTestLogger(&buf, 0)
+	l.setOptions(map[string]interface{}{
+		"sanitize":       true,
+		"maxFieldBytes":  10,
+		"redactFields":   []string{"password"},
+		"redactPatterns": []string{RedactEmail},
+	})
+	fields := []Field{
+		String("db_password", "hunter2"),
+		String("name", "\x1b[2Jx"),
+		String("mail", "bob@example.com"),
+		String("long", "0123456789abcdef"),
+		Int64("n", 1234567890123),
+		Err(errors.New("short")),
+	}
+	l.Logw(InfoLevel, "fields", fields)
+
+	want := `INFO fields db_password=[REDACTED] name=\x1b[2Jx mail=[REDACTED] ` +
+		`long="0123456789…[truncated 6 bytes]" n=1234567890123 error=short` + "\n"
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+	if fields[0].str != "hunter2" {
+		t.Errorf("caller's fields were modified")
+	}
+	if st := l.Stats(); st.Truncated != 1 {
+		t.Errorf("stats %+v", st)
+	}
+}
+
+func BenchmarkInfow(b *testing.B) {
+	l := newTestLogger(io.Discard, LstdFlags)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.Logw(InfoLevel, "request served", []Field{
+			String("path", "/api/v1/items"), Int("status", 200), Duration("took", time.Millisecond)})
+	}
+}
+
+func BenchmarkInfowJSON(b *testing.B) {
+	l := newTestLogger(io.Discard, LstdFlags)
+	l.setOptions(map[string]interface{}{"encoding": "json"})
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.Logw(InfoLevel, "request served", []Field{
+			String("path", "/api/v1/items"), Int("status", 200), Duration("took", time.Millisecond)})
+	}
+}
+
+type testUser struct {
+	Name     string
+	Password string `log:"-"`
+	Token    string `log:"token,redact"`
+	Address  struct {
+		City string `log:"city"`
+	} `log:"addr"`
+	Roles []string
+	Seen  time.Duration
+	Meta  map[string]int
+	note  string
+}
+
+type testPoint struct{ x, y int }
+
+func (p testPoint) MarshalLogObject(enc ObjectEncoder) error {
+	enc.AddInt64("x", int64(p.x))
+	enc.AddInt64("y", int64(p.y))
+	return nil
+}
+
+type testPath []testPoint
+
+func (p testPath) MarshalLogArray(enc ArrayEncoder) error {
+	for _, pt := range p {
+		enc.AppendObject(pt)
+	}
+	if len(p) > 2 {
+		return errors.New("too long")
+	}
+	return nil
+}
+
+func TestMarshalers(t *testing.T) {
+	u := testUser{Name: "bob", Password: "hunter2", Token: "abc", Roles: []string{"admin", "dev"},
+		Seen: time.Second, Meta: map[string]int{"b": 2, "a": 1}, note: "unexported"}
+	u.Address.City = "Paris"
+	fields := []Field{
+		Any("user", &u),
+		Object("pt", testPoint{1, 2}),
+		Array("path", testPath{{1, 2}, {3, 4}, {5, 6}}),
+		Any("secret", map[string]string{"api_key": "k"}),
+	}
+
+	tests := []struct {
+		encoding string
+		want     string
+	}{
+		{"text", `INFO shapes user.Name=bob user.token=[REDACTED] user.addr.city=Paris user.Roles=[admin,dev] ` +
+			`user.Seen=1s user.Meta.a=1 user.Meta.b=2 pt.x=1 pt.y=2 path="[{x=1 y=2},{x=3 y=4},{x=5 y=6}]" ` +
+			`pathError="too long" secret.api_key=[REDACTED]` + "\n"},
+		{"json", `{"time":"2015-09-30T08:00:00Z","level":"INFO","msg":"shapes","user":{"Name":"bob","token":"[REDACTED]",` +
+			`"addr":{"city":"Paris"},"Roles":["admin","dev"],"Seen":"1s","Meta":{"a":1,"b":2}},"pt":{"x":1,"y":2},` +
+			`"path":[{"x":1,"y":2},{"x":3,"y":4},{"x":5,"y":6}],"pathError":"too long","secret":{"api_key":"[REDACTED]"}}` + "\n"},
+	}
+	for _, tt := range tests {
+		l := newTestLogger(io.Discard, 0)
+		l.setOptions(map[string]interface{}{"encoding": tt.encoding, "redactFields": []string{"key"}})
+		e := &Entry{
+			Level:   InfoLevel,
+			Prefix:  "INFO",
+			Time:    time.Date(2015, 9, 30, 8, 0, 0, 0, time.UTC),
+			Message: "shapes",
+			Fields:  fields,
+		}
+		if got := string(l.encoder(InfoLevel).Encode(nil, 0, e)); got != tt.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", tt.encoding, got, tt.want)
+		}
+	}
+}
+
+func TestPrintfStructArgs(t *testing.T) {
+	var w bytes.Buffer
+	l := newTestLogger(&w, 0)
+	u := testUser{Name: "bob", Password: "hunter2", Token: "abc"}
+	args := []interface{}{&u, u, testPoint{1, 2}, u}
+	l.Info("%+v %v %s %T", args...)
+	l.Info("%[2]T %[1]v", &u, u)
+	got := w.String()
+	for _, want := range []string{"{Name=bob token=[REDACTED] ", "{x=1 y=2}", " glog.testUser\n", "INFO glog.testUser {Name=bob "} {
+		if !strings.Contains(got, want) {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+	if strings.Contains(got, "hunter2") || strings.Contains(got, "abc") {
+		t.Errorf("got %q, tagged fields logged", got)
+	}
+	if args[0] != &u {
+		t.Errorf("arguments were changed")
+	}
+}
+
+func TestReflectLimits(t *testing.T) {
+	type node struct {
+		Next *node
+	}
+	n := &node{}
+	n.Next = n
+	got := string(appendTextFields(nil, []Field{Any("n", n), Any("s", make([]int, maxReflectElements+5))}, nil))
+	if !strings.Contains(got, ` n.Next.Next.Next.Next.Next.Next.Next.Next="…" `) || !strings.HasSuffix(got, `,0,\"…5 more\"]"`) {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestStaticFields(t *testing.T) {
+	var w bytes.Buffer
+	l := newTestLogger(&w, 0)
+	options := map[string]interface{}{
+		"processFields": []string{"pid", "go"},
+		"staticFields":  []Field{String("service", "api"), String("token", "secret")},
+		"redactFields":  []string{"token"},
+	}
+	for _, encoding := range []string{"text", "json", "logfmt"} {
+		options["encoding"] = encoding
+		l.setOptions(options)
+		l.Logw(InfoLevel, "hi", []Field{Int("n", 1)})
+	}
+	want := fmt.Sprintf("INFO hi n=1\n"+
+		`{"time":"","level":"INFO","msg":"hi","pid":%[1]d,"go":"%[2]s","service":"api","token":"[REDACTED]","n":1}`+"\n"+
+		"time= level=INFO msg=hi pid=%[1]d go=%[2]s service=api token=[REDACTED] n=1\n",
+		os.Getpid(), runtime.Version())
+	got := regexp.MustCompile(`"time":"[^"]*"`).ReplaceAllString(w.String(), `"time":""`)
+	got = regexp.MustCompile(`time=[^ ]*`).ReplaceAllString(got, "time=")
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	l.setOptions(map[string]interface{}{"encoding": "binary", "staticFields": []Field{String("env", "prod")}})
+	buf := l.encoder(InfoLevel).Encode(nil, Lsequence, &Entry{Message: "m", Seq: 7, Fields: []Field{Bool("b", true)}})
+	rec, err := binlog.Decode(buf[1:])
+	if err != nil || fmt.Sprint(rec.Fields) != "[{seq 7} {env prod} {b true}]" {
+		t.Errorf("binary: %v, %v", rec, err)
+	}
+}
+
+type testErr struct{ msg string }
+
+func (e *testErr) Error() string { return e.msg }
+
+type testPanicErr struct{}
+
+func (testPanicErr) Error() string { panic("boom") }
+
+func TestErrorFields(t *testing.T) {
+	var nilErr *testErr
+	fields := []Field{Any("err", nilErr), Err(nilErr), Err(testPanicErr{})}
+	want := `INFO x err=<nil> error=<nil> error="%!v(PANIC=Error method: boom)"` + "\n"
+	for _, encoding := range []string{"text", "json", "logfmt", "binary"} {
+		var buf bytes.Buffer
+		l := newTestLogger(&buf, 0)
+		l.setOptions(map[string]interface{}{"encoding": encoding})
+		l.Logw(InfoLevel, "x", fields)
+		if encoding == "text" && buf.String() != want {
+			t.Errorf("got %s, want %s", buf.String(), want)
+		}
+		if encoding == "json" && !strings.Contains(buf.String(), `"err":"<nil>"`) {
+			t.Errorf("got %s", buf.String())
+		}
+	}
+}
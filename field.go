@@ -0,0 +1,282 @@
+package glog
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+type fieldType uint8
+
+const (
+	stringType fieldType = iota
+	int64Type
+	float64Type
+	boolType
+	durationType
+	timeType
+	errorType
+	anyType
+	objectType
+	arrayType
+)
+
+// A Field is a key-value pair attached to an entry. The typed constructors
+// keep the value unboxed, so encoders write it without reflection or fmt.
+type Field struct {
+	Key   string
+	typ   fieldType
+	num   int64
+	str   string
+	iface interface{}
+}
+
+// String constructs a field with a string value.
+func String(key string, val string) Field {
+	return Field{Key: key, typ: stringType, str: val}
+}
+
+// Int constructs a field with an int value.
+func Int(key string, val int) Field {
+	return Field{Key: key, typ: int64Type, num: int64(val)}
+}
+
+// Int64 constructs a field with an int64 value.
+func Int64(key string, val int64) Field {
+	return Field{Key: key, typ: int64Type, num: val}
+}
+
+// Float64 constructs a field with a float64 value.
+func Float64(key string, val float64) Field {
+	return Field{Key: key, typ: float64Type, num: int64(math.Float64bits(val))}
+}
+
+// Bool constructs a field with a bool value.
+func Bool(key string, val bool) Field {
+	var n int64
+	if val {
+		n = 1
+	}
+	return Field{Key: key, typ: boolType, num: n}
+}
+
+// Duration constructs a field with a time.Duration value.
+func Duration(key string, val time.Duration) Field {
+	return Field{Key: key, typ: durationType, num: int64(val)}
+}
+
+// Time constructs a field with a time.Time value.
+func Time(key string, val time.Time) Field {
+	// UnixNano only covers the years 1678 to 2262
+	if y := val.Year(); y < 1678 || y > 2261 {
+		return Field{Key: key, typ: timeType, iface: val}
+	}
+	return Field{Key: key, typ: timeType, num: val.UnixNano(), iface: val.Location()}
+}
+
+// Err constructs a field named "error" holding err.
+func Err(err error) Field {
+	if err == nil {
+		return Field{Key: "error", typ: anyType}
+	}
+	return Field{Key: "error", typ: errorType, iface: err}
+}
+
+// Any constructs a field with an arbitrary value. Values of the types
+// with a constructor of their own are stored as such, structs, maps and
+// slices are logged by reflection (see ObjectMarshaler for the log struct
+// tags), anything else is encoded with fmt or encoding/json.
+func Any(key string, val interface{}) Field {
+	switch v := val.(type) {
+	case string:
+		return String(key, v)
+	case int:
+		return Int(key, v)
+	case int64:
+		return Int64(key, v)
+	case int32:
+		return Int64(key, int64(v))
+	case uint32:
+		return Int64(key, int64(v))
+	case float64:
+		return Float64(key, v)
+	case float32:
+		return Float64(key, float64(v))
+	case bool:
+		return Bool(key, v)
+	case time.Duration:
+		return Duration(key, v)
+	case time.Time:
+		return Time(key, v)
+	case error:
+		return Field{Key: key, typ: errorType, iface: v}
+	case ObjectMarshaler:
+		return Object(key, v)
+	case ArrayMarshaler:
+		return Array(key, v)
+	case nil:
+		return Field{Key: key, typ: anyType}
+	}
+	return reflectField(key, reflect.ValueOf(val), 0)
+}
+
+func (f Field) time() time.Time {
+	if t, ok := f.iface.(time.Time); ok {
+		return t
+	}
+	t := time.Unix(0, f.num)
+	if loc, ok := f.iface.(*time.Location); ok {
+		t = t.In(loc)
+	}
+	return t
+}
+
+// isText reports whether the value is free text, the kind that can hold
+// secrets, control characters or runaway lengths.
+func (f Field) isText() bool {
+	return f.typ == stringType || f.typ == errorType || f.typ == anyType
+}
+
+// appendText appends the value the way it reads in a text line.
+func (f Field) appendText(dst []byte) []byte {
+	switch f.typ {
+	case stringType:
+		return append(dst, f.str...)
+	case int64Type:
+		return strconv.AppendInt(dst, f.num, 10)
+	case float64Type:
+		return strconv.AppendFloat(dst, math.Float64frombits(uint64(f.num)), 'g', -1, 64)
+	case boolType:
+		return strconv.AppendBool(dst, f.num != 0)
+	case durationType:
+		return append(dst, time.Duration(f.num).String()...)
+	case timeType:
+		return f.time().AppendFormat(dst, time.RFC3339Nano)
+	case errorType:
+		return append(dst, errorText(f.iface.(error))...)
+	case objectType, arrayType:
+		dst, _ = appendTextValue(dst, f, nil)
+		return dst
+	}
+	return fmt.Appendf(dst, "%v", f.iface)
+}
+
+// errorText returns the message of err, recovering as fmt does if Error
+// panics, such as on a nil pointer receiver.
+func errorText(err error) (s string) {
+	defer func() {
+		if r := recover(); r != nil {
+			if v := reflect.ValueOf(err); v.Kind() == reflect.Ptr && v.IsNil() {
+				s = "<nil>"
+				return
+			}
+			s = fmt.Sprintf("%%!v(PANIC=Error method: %v)", r)
+		}
+	}()
+	return err.Error()
+}
+
+// appendQuotedText appends the value as a logfmt value: quoted if it is
+// empty or holds spaces, quotes, '=' or anything unprintable.
+func (f Field) appendQuotedText(dst []byte) []byte {
+	if !f.isText() {
+		return f.appendText(dst)
+	}
+	start := len(dst)
+	dst = f.appendText(dst)
+	if !needsQuote(dst[start:]) {
+		return dst
+	}
+	tmp := getBuffer()
+	tmp.msg = append(tmp.msg, dst[start:]...)
+	dst = strconv.AppendQuote(dst[:start], tmp.message())
+	putBuffer(tmp)
+	return dst
+}
+
+func needsQuote(s []byte) bool {
+	if len(s) == 0 {
+		return true
+	}
+	for _, c := range s {
+		if c <= ' ' || c == '=' || c == '"' || c == 0x7f || c >= utf8.RuneSelf {
+			return true
+		}
+	}
+	return false
+}
+
+// appendJSON appends the value as JSON.
+func (f Field) appendJSON(dst []byte) []byte {
+	switch f.typ {
+	case int64Type:
+		return strconv.AppendInt(dst, f.num, 10)
+	case float64Type:
+		v := math.Float64frombits(uint64(f.num))
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return appendJSONString(dst, strconv.FormatFloat(v, 'g', -1, 64))
+		}
+		return strconv.AppendFloat(dst, v, 'g', -1, 64)
+	case boolType:
+		return strconv.AppendBool(dst, f.num != 0)
+	case objectType, arrayType:
+		o := jsonObject{buf: dst, array: true}
+		o.add(f)
+		return o.buf
+	case anyType:
+		if f.iface == nil {
+			return append(dst, "null"...)
+		}
+		if b, err := json.Marshal(f.iface); err == nil {
+			return append(dst, b...)
+		}
+	}
+	tmp := getBuffer()
+	tmp.msg = f.appendText(tmp.msg)
+	dst = appendJSONString(dst, tmp.message())
+	putBuffer(tmp)
+	return dst
+}
+
+// appendJSONString appends s as a quoted JSON string. Invalid UTF-8 is
+// replaced by U+FFFD.
+func appendJSONString(dst []byte, s string) []byte {
+	dst = append(dst, '"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				dst = append(dst, '\\', c)
+			case c == '\n':
+				dst = append(dst, '\\', 'n')
+			case c == '\r':
+				dst = append(dst, '\\', 'r')
+			case c == '\t':
+				dst = append(dst, '\\', 't')
+			case c < ' ':
+				dst = append(dst, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xf])
+			default:
+				dst = append(dst, c)
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			dst = append(dst, "\ufffd"...)
+		case r == '\u2028' || r == '\u2029':
+			// valid JSON, but line terminators for JavaScript
+			dst = append(dst, '\\', 'u', '2', '0', '2', hexDigits[r&0xf])
+		default:
+			dst = append(dst, s[i:i+size]...)
+		}
+		i += size
+	}
+	return append(dst, '"')
+}
@@ -0,0 +1,104 @@
+package glog
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readLogs closes fl and returns the contents of its files by the name
+// they had before the date suffix was added on close.
+func readLogs(t *testing.T, fl *fileLogger) map[string]string {
+	fl.Close()
+	fns, err := filepath.Glob(filepath.Join(fl.dir, "*.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs := make(map[string]string)
+	for _, fn := range fns {
+		b, err := os.ReadFile(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := strings.SplitN(filepath.Base(fn), "-", 2)[0]
+		logs[name] = string(b)
+	}
+	return logs
+}
+
+func TestRouting(t *testing.T) {
+	tests := []struct {
+		options map[string]interface{}
+		want    map[string]string
+	}{
+		{map[string]interface{}{"routing": "combined", "combinedFile": "all"},
+			map[string]string{"all": "DEBUG d\nINFO i\nERROR e\n"}},
+		{map[string]interface{}{"routing": "cascade", "skipDisabled": true, "level": InfoLevel},
+			map[string]string{"INFO": "INFO i\nERROR e\n", "WARN": "ERROR e\n", "ERROR": "ERROR e\n",
+				"FATAL": "", "PANIC": ""}},
+		{map[string]interface{}{"routing": "combined", "combinedFile": "buf", "buffered": true, "flushLevel": PanicLevel},
+			map[string]string{"buf": "DEBUG d\nINFO i\nERROR e\n"}},
+		{map[string]interface{}{"files": map[int]string{ErrorLevel: "problems", WarnLevel: "problems", DebugLevel: "debug"}},
+			map[string]string{"problems": "ERROR e\n", "debug": "DEBUG d\n"}},
+	}
+	for _, tt := range tests {
+		tt.options["dir"] = t.TempDir()
+		tt.options["flag"] = 0
+		tt.options["prefix"] = prefixFn
+		fl := createFileLogger(tt.options)
+		fl.Debug("d")
+		fl.Info("i")
+		fl.Error("e")
+		logs := readLogs(t, fl)
+		if len(logs) != len(tt.want) {
+			t.Errorf("%v: got files %v, want %v", tt.options, logs, tt.want)
+			continue
+		}
+		for name, want := range tt.want {
+			if got := logs[name]; got != want {
+				t.Errorf("%v: %s has %q, want %q", tt.options["routing"], name, got, want)
+			}
+		}
+	}
+}
+
+func TestRoutingLevelEncoding(t *testing.T) {
+	tests := []struct {
+		options map[string]interface{}
+		kept    bool
+		want    map[string]string
+	}{
+		// DEBUG.log would get binary and text entries, the levelEncoding is
+		// dropped
+		{map[string]interface{}{"routing": "cascade", "levelEncoding": map[int]string{DebugLevel: "binary"}},
+			false, map[string]string{"DEBUG": "DEBUG d\nINFO i\n", "INFO": "INFO i\n"}},
+		{map[string]interface{}{"routing": "combined", "combinedFile": "all", "levelEncoding": map[int]string{InfoLevel: "json"}},
+			false, map[string]string{"all": "DEBUG d\nINFO i\n"}},
+		// the same encoding everywhere is fine
+		{map[string]interface{}{"routing": "combined", "combinedFile": "all", "encoding": "logfmt",
+			"levelEncoding": map[int]string{DebugLevel: "logfmt"}},
+			true, nil},
+		// and so are files of their own
+		{map[string]interface{}{"files": map[int]string{DebugLevel: "debug", InfoLevel: "info"},
+			"levelEncoding": map[int]string{DebugLevel: "binary"}},
+			true, map[string]string{"info": "INFO i\n"}},
+	}
+	for _, tt := range tests {
+		tt.options["dir"] = t.TempDir()
+		tt.options["flag"] = 0
+		tt.options["prefix"] = prefixFn
+		fl := createFileLogger(tt.options)
+		if kept := fl.levelEnc != nil; kept != tt.kept {
+			t.Errorf("%v: levelEncoding kept %v", tt.options, kept)
+		}
+		fl.Debug("d")
+		fl.Info("i")
+		logs := readLogs(t, fl)
+		for name, want := range tt.want {
+			if got := logs[name]; got != want {
+				t.Errorf("%v: %s has %q, want %q", tt.options, name, got, want)
+			}
+		}
+	}
+}
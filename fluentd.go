@@ -0,0 +1,355 @@
+package glog
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Modes of the Fluentd forward protocol.
+const (
+	fluentMessage       = iota // [tag, time, record, option] for each entry
+	fluentForward              // [tag, [[time, record], ...], option]
+	fluentPackedForward        // [tag, bin of [time, record] ..., option]
+)
+
+// fluentEncoder writes entries as the [time, record] pairs of the Fluentd
+// forward protocol, in msgpack. The time is an EventTime, the record holds
+// level, message, caller if the flags ask for it, the static fields and
+// the fields of the entry.
+type fluentEncoder struct {
+	redact  *redactor
+	static  []byte // the encoded static fields, keys and values
+	nstatic int
+}
+
+func (fe fluentEncoder) Encode(buf []byte, flag int, e *Entry) []byte {
+	buf = append(buf, 0x92)
+	buf = appendMsgpackEventTime(buf, e.Time)
+	o := msgpackObject{buf: buf, redact: fe.redact}
+	o.begin()
+	o.buf = appendMsgpackString(o.buf, "level")
+	o.buf = appendMsgpackString(o.buf, levelName(e.Level))
+	o.buf = appendMsgpackString(o.buf, "message")
+	o.buf = appendMsgpackString(o.buf, strings.TrimSuffix(e.Message, "\n"))
+	o.n = 2
+	if e.File != "" {
+		tmp := getBuffer()
+		tmp.msg = append(tmp.msg, callerFile(flag, e.File)...)
+		tmp.msg = append(tmp.msg, ':')
+		tmp.msg = strconv.AppendInt(tmp.msg, int64(e.Line), 10)
+		o.buf = appendMsgpackString(o.buf, "caller")
+		o.buf = appendMsgpackString(o.buf, tmp.message())
+		putBuffer(tmp)
+		o.n++
+	}
+	if flag&Linstance != 0 {
+		o.add(String("instance", instanceID))
+	}
+	if flag&Lsequence != 0 {
+		o.add(Int64("seq", int64(e.Seq)))
+	}
+	o.buf = append(o.buf, fe.static...)
+	o.n += fe.nstatic
+	for i := range e.Fields {
+		o.add(e.Fields[i])
+	}
+	return o.end()
+}
+
+// fluentBatch holds the [time, record] pairs of one tag.
+type fluentBatch struct {
+	entries []byte
+	n       int
+}
+
+// fluentWriter sends entries to Fluentd or Fluent Bit. In the forward
+// modes the entries of each tag are batched, up to batchSize entries or
+// batchBytes, and at least every flushInterval. The connection, retries
+// and what is kept while it is down are left to w.
+type fluentWriter struct {
+	mu         sync.Mutex
+	w          *netWriter
+	mode       int
+	chunk      bool // ask for acks
+	batchSize  int
+	batchBytes int
+	tags       [LevelCount]string
+	batches    [LevelCount]fluentBatch
+	msg        []byte
+	stop       chan struct{}
+	onError    func(error)
+}
+
+// fluentTagWriter is the writer of one level, and so of one tag.
+type fluentTagWriter struct {
+	fw *fluentWriter
+	lv int
+}
+
+func (tw fluentTagWriter) Write(p []byte) (int, error) {
+	return tw.fw.add(tw.lv, p)
+}
+
+func (tw fluentTagWriter) Flush() error {
+	return tw.fw.Flush()
+}
+
+func (tw fluentTagWriter) Close() error {
+	return tw.fw.Close()
+}
+
+func (fw *fluentWriter) add(lv int, p []byte) (int, error) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	if fw.mode == fluentMessage {
+		// p is [time, record], the message puts the tag in front
+		fw.msg = append(fw.msg[:0], 0x93)
+		if fw.chunk {
+			fw.msg[0] = 0x94
+		}
+		fw.msg = appendMsgpackString(fw.msg, fw.tags[lv])
+		fw.msg = append(fw.msg, p[1:]...)
+		if fw.chunk {
+			fw.msg = fw.appendOption(fw.msg, 0)
+		}
+		if _, err := fw.w.Write(fw.msg); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	b := &fw.batches[lv]
+	b.entries = append(b.entries, p...)
+	b.n++
+	if b.n >= fw.batchSize || len(b.entries) >= fw.batchBytes {
+		if err := fw.send(lv); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// send writes the batch of level lv as one message.
+func (fw *fluentWriter) send(lv int) error {
+	b := &fw.batches[lv]
+	if b.n == 0 {
+		return nil
+	}
+	fw.msg = append(fw.msg[:0], 0x93)
+	fw.msg = appendMsgpackString(fw.msg, fw.tags[lv])
+	if fw.mode == fluentPackedForward {
+		fw.msg = appendMsgpackBinHeader(fw.msg, len(b.entries))
+	} else {
+		fw.msg = appendMsgpackArrayHeader(fw.msg, b.n)
+	}
+	fw.msg = append(fw.msg, b.entries...)
+	fw.msg = fw.appendOption(fw.msg, b.n)
+	b.entries, b.n = b.entries[:0], 0
+	_, err := fw.w.Write(fw.msg)
+	return err
+}
+
+// appendOption appends the option map, with the number of entries if n
+// is not 0 and, when acks are asked for, a new chunk ID last: fluentAck
+// finds it at the end of the message.
+func (fw *fluentWriter) appendOption(dst []byte, n int) []byte {
+	switch {
+	case n > 0 && fw.chunk:
+		dst = appendMsgpackMapHeader(dst, 2)
+	case n > 0 || fw.chunk:
+		dst = appendMsgpackMapHeader(dst, 1)
+	default:
+		return appendMsgpackMapHeader(dst, 0)
+	}
+	if n > 0 {
+		dst = appendMsgpackString(dst, "size")
+		dst = appendMsgpackInt(dst, int64(n))
+	}
+	if fw.chunk {
+		var id [18]byte
+		rand.Read(id[:])
+		dst = appendMsgpackString(dst, "chunk")
+		dst = appendMsgpackString(dst, base64.StdEncoding.EncodeToString(id[:]))
+	}
+	return dst
+}
+
+// fluentChunkLen is the length of a chunk ID, 18 random bytes in base64.
+const fluentChunkLen = 24
+
+// fluentAckLimit is the largest ack read, {"ack": chunk} takes 30 bytes.
+const fluentAckLimit = 4 << 10
+
+// fluentAck waits for the ack of the message p, {"ack": chunk}. What is
+// read ahead of an ack is kept for the next one of the connection.
+func fluentAck(timeout time.Duration) func(c net.Conn, p []byte) error {
+	var (
+		conn net.Conn
+		r    *bufio.Reader
+	)
+	return func(c net.Conn, p []byte) error {
+		if c != conn {
+			conn, r = c, bufio.NewReaderSize(c, 256)
+		}
+		chunk := string(p[len(p)-fluentChunkLen:])
+		c.SetReadDeadline(time.Now().Add(timeout))
+		v, err := readMsgpack(r, fluentAckLimit)
+		if err != nil {
+			return err
+		}
+		if m, ok := v.(map[string]interface{}); !ok || m["ack"] != chunk {
+			return fmt.Errorf("glog: fluentd ack %v, want %s", v, chunk)
+		}
+		return nil
+	}
+}
+
+// sendAll hands the batches to w.
+func (fw *fluentWriter) sendAll() error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	var first error
+	for lv := range fw.batches {
+		if err := fw.send(lv); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Flush sends the batches and waits until w sent them, or failed to.
+func (fw *fluentWriter) Flush() error {
+	err := fw.sendAll()
+	if werr := fw.w.Flush(); err == nil {
+		err = werr
+	}
+	return err
+}
+
+func (fw *fluentWriter) flushRoutine(interval time.Duration, stop chan struct{}) {
+	tk := time.NewTicker(interval)
+	defer tk.Stop()
+	for {
+		select {
+		case <-tk.C:
+			if err := fw.sendAll(); err != nil && fw.onError != nil {
+				fw.onError(err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Close sends the batches and closes the connection. The writers of all
+// levels share fw, only the first Close does anything.
+func (fw *fluentWriter) Close() error {
+	fw.mu.Lock()
+	stop := fw.stop
+	fw.stop = nil
+	fw.mu.Unlock()
+	if stop == nil {
+		return nil
+	}
+	close(stop)
+	err := fw.sendAll()
+	if cerr := fw.w.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// createFluentdLogger returns a Logger sending its entries to Fluentd or
+// Fluent Bit with the forward protocol.
+//
+// options:
+//
+//	network: string, "tcp" (default) or "unix"
+//	addr: string, host:port or the socket path, 127.0.0.1:24224 by default
+//	tag: string, the tags are tag.level, such as app.info; the program
+//	     name by default
+//	mode: string, "message" sends each entry on its own, "forward"
+//	      (default) and "packedForward" in batches
+//	batchSize: int, the most entries of a batch, 100 by default
+//	batchBytes: int, a batch is sent once this large, 64KB by default
+//	flushInterval: time.Duration, the longest a batch waits, 1s by default
+//	chunk: bool, ask for an ack of each message, which is sent again
+//	       until there is one
+//	ackTimeout: time.Duration, 5s by default
+//	the options of the net sink, see createNetLogger, but framing
+//	and the Logger options, see setOptions, but encoding and buffered
+func createFluentdLogger(options map[string]interface{}) *Logger {
+	w := newNetWriter(options)
+	if w.addr == "" {
+		w.addr = "127.0.0.1:24224"
+	}
+	fw := &fluentWriter{w: w, mode: fluentForward, batchSize: 100, batchBytes: 64 << 10, stop: make(chan struct{})}
+	if s, ok := options["mode"].(string); ok {
+		switch s {
+		case "message":
+			fw.mode = fluentMessage
+		case "forward":
+		case "packedForward":
+			fw.mode = fluentPackedForward
+		default:
+			log.Printf("fluentd mode [%s] invalid, must be message, forward or packedForward, set to forward\n", s)
+		}
+	}
+	if n, ok := options["batchSize"].(int); ok && n > 0 {
+		fw.batchSize = n
+	}
+	if n, ok := options["batchBytes"].(int); ok && n > 0 {
+		fw.batchBytes = n
+	}
+	if fw.chunk, _ = options["chunk"].(bool); fw.chunk {
+		timeout, ok := options["ackTimeout"].(time.Duration)
+		if !ok || timeout <= 0 {
+			timeout = 5 * time.Second
+		}
+		w.ack = fluentAck(timeout)
+	}
+	tag, _ := options["tag"].(string)
+	if tag == "" {
+		tag = program
+	}
+	for lv := range fw.tags {
+		fw.tags[lv] = tag + "." + strings.ToLower(levelName(lv))
+	}
+
+	flag, _ := options["flag"].(int)
+	l := &Logger{flag: int32(flag)}
+	l.prefix.Store(prefixFn)
+	l.out.out = make(map[int]io.WriteCloser)
+	for i := DebugLevel; i < LevelCount; i++ {
+		l.out.out[i] = fluentTagWriter{fw, i}
+	}
+	// the static fields are encoded below, not by a structured encoder
+	l.setOptions(withoutOptions(options, "buffered", "processFields", "staticFields"))
+	fe := fluentEncoder{redact: l.redact}
+	o := msgpackObject{redact: l.redact}
+	for _, f := range l.staticFields(options) {
+		o.add(f)
+	}
+	fe.static, fe.nstatic = o.buf, o.n
+	l.enc = fe
+	l.levelEnc = nil
+	fw.onError = l.onError
+
+	if fw.mode != fluentMessage {
+		interval, ok := options["flushInterval"].(time.Duration)
+		if !ok || interval <= 0 {
+			interval = time.Second
+		}
+		go fw.flushRoutine(interval, fw.stop)
+	}
+	return l
+}
@@ -0,0 +1,260 @@
+package glog
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fluentEvent is an entry as the fake forward server got it.
+type fluentEvent struct {
+	tag    string
+	time   time.Time
+	record map[string]interface{}
+	chunk  string
+}
+
+// fakeFluentd is a forward protocol server for the tests. It acks the
+// messages that ask for it, but for the first noAck ones, after which it
+// drops the connection instead.
+type fakeFluentd struct {
+	ln     net.Listener
+	events chan fluentEvent
+	mu     sync.Mutex
+	noAck  int
+}
+
+func newFakeFluentd(t *testing.T) *fakeFluentd {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	f := &fakeFluentd{ln: ln, events: make(chan fluentEvent, 100)}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(t, c)
+		}
+	}()
+	return f
+}
+
+func (f *fakeFluentd) serve(t *testing.T, c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	for {
+		v, err := readMsgpack(r, 64<<20)
+		if err != nil {
+			if err != io.EOF {
+				t.Error(err)
+			}
+			return
+		}
+		msg := v.([]interface{})
+		tag := msg[0].(string)
+		var events []fluentEvent
+		var option map[string]interface{}
+		switch entries := msg[1].(type) {
+		case time.Time: // message
+			events = append(events, fluentEvent{tag: tag, time: entries, record: msg[2].(map[string]interface{})})
+			if len(msg) > 3 {
+				option = msg[3].(map[string]interface{})
+			}
+		case []interface{}: // forward
+			for _, e := range entries {
+				pair := e.([]interface{})
+				events = append(events, fluentEvent{tag: tag, time: pair[0].(time.Time), record: pair[1].(map[string]interface{})})
+			}
+			option = msg[2].(map[string]interface{})
+		case []byte: // packed forward
+			for pr := bytes.NewReader(entries); pr.Len() > 0; {
+				e, err := readMsgpack(pr, pr.Len())
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				pair := e.([]interface{})
+				events = append(events, fluentEvent{tag: tag, time: pair[0].(time.Time), record: pair[1].(map[string]interface{})})
+			}
+			option = msg[2].(map[string]interface{})
+		}
+		if n, ok := option["size"]; ok && n != int64(len(events)) {
+			t.Errorf("size %v, got %d entries", n, len(events))
+		}
+		chunk, _ := option["chunk"].(string)
+		for _, e := range events {
+			e.chunk = chunk
+			f.events <- e
+		}
+		if chunk == "" {
+			continue
+		}
+		f.mu.Lock()
+		drop := f.noAck > 0
+		f.noAck--
+		f.mu.Unlock()
+		if drop {
+			return
+		}
+		ack := appendMsgpackMapHeader(nil, 1)
+		ack = appendMsgpackString(ack, "ack")
+		c.Write(appendMsgpackString(ack, chunk))
+	}
+}
+
+func (f *fakeFluentd) next(t *testing.T) fluentEvent {
+	select {
+	case e := <-f.events:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event")
+	}
+	return fluentEvent{}
+}
+
+type point struct{ x, y int }
+
+func (p point) MarshalLogObject(enc ObjectEncoder) error {
+	enc.AddInt64("x", int64(p.x))
+	enc.AddInt64("y", int64(p.y))
+	return nil
+}
+
+func TestFluentEncoder(t *testing.T) {
+	e := &Entry{
+		Level:   WarnLevel,
+		Time:    testTime.Add(123 * time.Nanosecond),
+		Seq:     9,
+		File:    "/src/app/main.go",
+		Line:    42,
+		Message: "moved\n",
+		Fields:  []Field{Object("to", point{1, 2}), Float64("f", 0.5), Bool("b", true), Duration("d", time.Second)},
+	}
+	static := msgpackObject{}
+	static.add(String("env", "prod"))
+	fe := fluentEncoder{static: static.buf, nstatic: static.n}
+	v, err := readMsgpack(bytes.NewReader(fe.Encode(nil, Lshortfile|Lsequence, e)), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair := v.([]interface{})
+	if tm := pair[0].(time.Time); !tm.Equal(e.Time) {
+		t.Errorf("time %v, want %v", tm, e.Time)
+	}
+	r := pair[1].(map[string]interface{})
+	want := map[string]interface{}{
+		"level": "WARN", "message": "moved", "caller": "main.go:42", "seq": int64(9), "env": "prod",
+		"f": 0.5, "b": true, "d": "1s",
+	}
+	for k, v := range want {
+		if r[k] != v {
+			t.Errorf("%s: got %#v, want %#v", k, r[k], v)
+		}
+	}
+	if to, ok := r["to"].(map[string]interface{}); !ok || to["x"] != int64(1) || to["y"] != int64(2) {
+		t.Errorf("to: got %#v", r["to"])
+	}
+	if len(r) != len(want)+1 {
+		t.Errorf("got %d keys: %v", len(r), r)
+	}
+}
+
+func TestReadMsgpackLimit(t *testing.T) {
+	for _, p := range [][]byte{
+		{0xdb, 0xff, 0xff, 0xff, 0xff},       // a string of 4GB
+		{0xdd, 0x7f, 0xff, 0xff, 0xff},       // an array of 2G values
+		{0xdf, 0x7f, 0xff, 0xff, 0xff},       // a map of 2G pairs
+		{0x91, 0x91, 0x91, 0xc4, 0xff, 0x00}, // nested, 255 bytes at the end
+	} {
+		if _, err := readMsgpack(bytes.NewReader(p), 64); !errors.Is(err, errMsgpack) {
+			t.Errorf("% x: got %v", p, err)
+		}
+	}
+	ack := appendMsgpackMapHeader(nil, 1)
+	ack = appendMsgpackString(ack, "ack")
+	ack = appendMsgpackString(ack, strings.Repeat("x", fluentChunkLen))
+	if v, err := readMsgpack(bytes.NewReader(ack), len(ack)); err != nil || v.(map[string]interface{})["ack"] == nil {
+		t.Errorf("got %v, %v", v, err)
+	}
+}
+
+func TestFluentdModes(t *testing.T) {
+	f := newFakeFluentd(t)
+	defer f.ln.Close()
+	for _, mode := range []string{"message", "forward", "packedForward"} {
+		l := createFluentdLogger(map[string]interface{}{
+			"addr": f.ln.Addr().String(), "tag": "app", "mode": mode, "flushInterval": time.Hour,
+		})
+		l.Info("one")
+		l.Logw(InfoLevel, "two", []Field{Int("n", 2)})
+		l.Error("three")
+		l.Flush()
+		got := map[string]fluentEvent{}
+		for i := 0; i < 3; i++ {
+			e := f.next(t)
+			got[e.record["message"].(string)] = e
+		}
+		if got["one"].tag != "app.info" || got["two"].record["n"] != int64(2) || got["three"].tag != "app.error" {
+			t.Errorf("%s: got %v", mode, got)
+		}
+		if time.Since(got["one"].time) > time.Minute {
+			t.Errorf("%s: time %v", mode, got["one"].time)
+		}
+		l.Close()
+	}
+}
+
+func TestFluentdBatch(t *testing.T) {
+	f := newFakeFluentd(t)
+	defer f.ln.Close()
+	l := createFluentdLogger(map[string]interface{}{
+		"addr": f.ln.Addr().String(), "batchSize": 2, "flushInterval": 20 * time.Millisecond,
+	})
+	defer l.Close()
+	// a full batch goes at once, the rest after flushInterval
+	l.Info("one")
+	l.Info("two")
+	l.Info("three")
+	for _, want := range []string{"one", "two", "three"} {
+		if e := f.next(t); e.record["message"] != want {
+			t.Errorf("got %v, want %s", e.record["message"], want)
+		}
+	}
+}
+
+func TestFluentdAck(t *testing.T) {
+	f := newFakeFluentd(t)
+	defer f.ln.Close()
+	f.noAck = 1
+	errs := make(chan error, 10)
+	l := createFluentdLogger(map[string]interface{}{
+		"addr": f.ln.Addr().String(), "mode": "message", "chunk": true,
+		"ackTimeout": time.Second, "backoff": 10 * time.Millisecond,
+		"onError": func(err error) { errs <- err },
+	})
+	defer l.Close()
+
+	// without an ack the message is kept and sent again, same chunk
+	l.Info("one")
+	first := f.next(t)
+	if first.chunk == "" {
+		t.Fatalf("no chunk")
+	}
+	<-errs
+	l.Info("two")
+	if e := f.next(t); e.record["message"] != "one" || e.chunk != first.chunk {
+		t.Errorf("got %v %s, want one again with chunk %s", e.record["message"], e.chunk, first.chunk)
+	}
+	if e := f.next(t); e.record["message"] != "two" || e.chunk == first.chunk {
+		t.Errorf("got %v %s", e.record["message"], e.chunk)
+	}
+}
@@ -0,0 +1,265 @@
+package glog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// gelfEncoder writes entries as GELF 1.1 messages:
+//
+//	{"version":"1.1","host":"web1","short_message":"disk full",
+//	"timestamp":1443600000.000000,"level":4,"_file":"main.go","_line":42,
+//	"_dev":"/dev/sda1"}
+//
+// The level is the syslog severity, a message of several lines is the
+// full_message and its first line the short_message. Fields are additional
+// fields, numbers as numbers and anything else as text.
+type gelfEncoder struct {
+	host   string
+	redact *redactor // for the values nested in object and array fields
+	static []byte    // the encoded static fields, each starting with a comma
+}
+
+func (ge gelfEncoder) Encode(buf []byte, flag int, e *Entry) []byte {
+	msg := strings.TrimSuffix(e.Message, "\n")
+	buf = append(buf, `{"version":"1.1","host":`...)
+	buf = appendJSONString(buf, ge.host)
+	buf = append(buf, `,"short_message":`...)
+	if i := strings.IndexByte(msg, '\n'); i >= 0 {
+		buf = appendJSONString(buf, msg[:i])
+		buf = append(buf, `,"full_message":`...)
+	}
+	buf = appendJSONString(buf, msg)
+	buf = append(buf, `,"timestamp":`...)
+	buf = strconv.AppendInt(buf, e.Time.Unix(), 10)
+	buf = append(buf, '.')
+	us := e.Time.Nanosecond() / 1000
+	for d := 100000; d > 0; d /= 10 {
+		buf = append(buf, byte('0'+us/d%10))
+	}
+	buf = append(buf, `,"level":`...)
+	buf = strconv.AppendInt(buf, int64(syslogSeverity[e.Level]), 10)
+	if e.File != "" {
+		buf = append(buf, `,"_file":`...)
+		buf = appendJSONString(buf, callerFile(flag, e.File))
+		buf = append(buf, `,"_line":`...)
+		buf = strconv.AppendInt(buf, int64(e.Line), 10)
+	}
+	if flag&Linstance != 0 {
+		buf = append(buf, `,"_instance":"`...)
+		buf = append(buf, instanceID...)
+		buf = append(buf, '"')
+	}
+	if flag&Lsequence != 0 {
+		buf = append(buf, `,"_seq":`...)
+		buf = strconv.AppendUint(buf, e.Seq, 10)
+	}
+	buf = append(buf, ge.static...)
+	for i := range e.Fields {
+		buf = ge.appendField(buf, e.Fields[i])
+	}
+	return append(buf, '}')
+}
+
+// appendField appends ,"_key":value. Keys keep letters, digits,
+// underscores, dots and dashes; "_id" is reserved and becomes "_id_".
+func (ge gelfEncoder) appendField(buf []byte, f Field) []byte {
+	buf = append(buf, `,"_`...)
+	for i := 0; i < len(f.Key); i++ {
+		c := f.Key[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '.' || c == '-') {
+			c = '_'
+		}
+		buf = append(buf, c)
+	}
+	if f.Key == "id" {
+		buf = append(buf, '_')
+	}
+	buf = append(buf, '"', ':')
+	switch f.typ {
+	case int64Type, float64Type:
+		return f.appendJSON(buf)
+	case objectType, arrayType:
+		tmp := getBuffer()
+		tmp.msg, _ = appendTextValue(tmp.msg, f, ge.redact)
+		buf = appendJSONString(buf, tmp.message())
+		putBuffer(tmp)
+		return buf
+	}
+	tmp := getBuffer()
+	tmp.msg = f.appendText(tmp.msg)
+	buf = appendJSONString(buf, tmp.message())
+	putBuffer(tmp)
+	return buf
+}
+
+// gelfChunkMagic starts each chunk of a chunked GELF message.
+var gelfChunkMagic = [2]byte{0x1e, 0x0f}
+
+// gelfMaxChunks is the most chunks a GELF message may have.
+const gelfMaxChunks = 128
+
+// gelfWriter compresses and chunks GELF messages for UDP, where each
+// Write of w is a datagram; over TCP it leaves the framing to w.
+type gelfWriter struct {
+	w         *netWriter
+	udp       bool
+	compress  string // "gzip", "zlib" or "none"
+	chunkSize int
+	id        uint64 // the last message ID
+
+	zbuf  bytes.Buffer
+	gz    *gzip.Writer
+	zl    *zlib.Writer
+	chunk []byte
+}
+
+func (gw *gelfWriter) Write(p []byte) (int, error) {
+	if !gw.udp {
+		return gw.w.Write(p)
+	}
+	data := p
+	if gw.compress != "none" {
+		gw.zbuf.Reset()
+		var zw io.WriteCloser
+		if gw.compress == "zlib" {
+			if gw.zl == nil {
+				gw.zl = zlib.NewWriter(&gw.zbuf)
+			} else {
+				gw.zl.Reset(&gw.zbuf)
+			}
+			zw = gw.zl
+		} else {
+			if gw.gz == nil {
+				gw.gz = gzip.NewWriter(&gw.zbuf)
+			} else {
+				gw.gz.Reset(&gw.zbuf)
+			}
+			zw = gw.gz
+		}
+		zw.Write(p)
+		zw.Close()
+		data = gw.zbuf.Bytes()
+	}
+	if len(data) <= gw.chunkSize {
+		if _, err := gw.w.Write(data); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	// the chunk header takes 12 bytes of the datagram
+	size := gw.chunkSize - 12
+	n := (len(data) + size - 1) / size
+	if n > gelfMaxChunks {
+		return 0, fmt.Errorf("glog: GELF message of %d bytes needs %d chunks, at most %d are allowed", len(data), n, gelfMaxChunks)
+	}
+	gw.id++
+	var first error
+	for i := 0; i < n; i++ {
+		part := data[i*size:]
+		if len(part) > size {
+			part = part[:size]
+		}
+		gw.chunk = append(gw.chunk[:0], gelfChunkMagic[:]...)
+		gw.chunk = binary.BigEndian.AppendUint64(gw.chunk, gw.id)
+		gw.chunk = append(gw.chunk, byte(i), byte(n))
+		gw.chunk = append(gw.chunk, part...)
+		if _, err := gw.w.Write(gw.chunk); err != nil && first == nil {
+			first = err
+		}
+	}
+	if first != nil {
+		return 0, first
+	}
+	return len(p), nil
+}
+
+func (gw *gelfWriter) Flush() error {
+	return gw.w.Flush()
+}
+
+func (gw *gelfWriter) Close() error {
+	return gw.w.Close()
+}
+
+// frameNull ends each entry with a null byte, the framing of GELF over
+// TCP.
+func frameNull(dst, p []byte) []byte {
+	return append(append(dst, p...), 0)
+}
+
+// createGelfLogger returns a Logger sending its entries to Graylog as
+// GELF messages.
+//
+// options:
+//
+//	network: string, "udp" (default) or "tcp"; over tcp messages end with
+//	         a null byte and are not compressed
+//	addr: string, host:port of the GELF input
+//	host: string, the host of the messages, the short hostname by default
+//	compress: string, on udp "gzip" (default), "zlib" or "none"
+//	chunkSize: int, on udp the largest datagram, 1420 by default; larger
+//	           messages are sent in up to 128 chunks
+//	flag: int, Lshortfile or Llongfile add _file and _line, Linstance and
+//	      Lsequence _instance and _seq
+//	the options of the net sink, see createNetLogger, but framing
+//	and the Logger options, see setOptions, but encoding and buffered
+func createGelfLogger(options map[string]interface{}) *Logger {
+	w := newNetWriter(options)
+	if options["network"] == nil {
+		w.network = "udp"
+	}
+	gw := &gelfWriter{w: w, udp: !w.stream(), compress: "gzip", chunkSize: 1420}
+	if gw.udp {
+		var id [8]byte
+		rand.Read(id[:])
+		gw.id = binary.BigEndian.Uint64(id[:])
+		if s, ok := options["compress"].(string); ok {
+			switch s {
+			case "gzip", "zlib", "none":
+				gw.compress = s
+			default:
+				log.Printf("compress [%s] invalid, must be gzip, zlib or none, set to gzip\n", s)
+			}
+		}
+		if n, ok := options["chunkSize"].(int); ok {
+			if n > 12 {
+				gw.chunkSize = n
+			} else {
+				log.Printf("chunkSize [%d] invalid, set to 1420\n", n)
+			}
+		}
+	} else {
+		w.frame = frameNull
+	}
+	ge := gelfEncoder{host: host}
+	if s, ok := options["host"].(string); ok && s != "" {
+		ge.host = s
+	}
+
+	flag, _ := options["flag"].(int)
+	l := &Logger{flag: int32(flag)}
+	l.prefix.Store(prefixFn)
+	l.out.out = make(map[int]io.WriteCloser)
+	for i := DebugLevel; i < LevelCount; i++ {
+		l.out.out[i] = gw
+	}
+	// the static fields are encoded below, not by a structured encoder
+	l.setOptions(withoutOptions(options, "buffered", "processFields", "staticFields"))
+	ge.redact = l.redact
+	for _, f := range l.staticFields(options) {
+		ge.static = ge.appendField(ge.static, f)
+	}
+	l.enc = ge
+	l.levelEnc = nil
+	return l
+}
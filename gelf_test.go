@@ -0,0 +1,133 @@
+package glog
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGelfEncoder(t *testing.T) {
+	e := &Entry{
+		Level:   ErrorLevel,
+		Time:    testTime.Add(1500 * time.Microsecond),
+		File:    "/src/app/main.go",
+		Line:    42,
+		Message: "failed\nstack\n",
+		Fields:  []Field{String("dev", "sda"), Int("pct", 99), Bool("ok", false), String("id", "x"), String("a b", "c")},
+	}
+	got := string(gelfEncoder{host: "web1"}.Encode(nil, Lshortfile, e))
+	want := `{"version":"1.1","host":"web1","short_message":"failed","full_message":"failed\nstack",` +
+		`"timestamp":1443600000.001500,"level":3,"_file":"main.go","_line":42,` +
+		`"_dev":"sda","_pct":99,"_ok":"false","_id_":"x","_a_b":"c"}`
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
+
+// readGelf reads a GELF datagram, putting chunked messages together.
+func readGelf(t *testing.T, pc net.PacketConn) (m map[string]interface{}, chunked int) {
+	buf := make([]byte, 65536)
+	var chunks [][]byte
+	for {
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := append([]byte(nil), buf[:n]...)
+		if p[0] == 0x1e && p[1] == 0x0f {
+			chunked++
+			seq, count := int(p[10]), int(p[11])
+			if chunks == nil {
+				chunks = make([][]byte, count)
+			}
+			if len(chunks) > 1 && binary.BigEndian.Uint64(p[2:]) == 0 {
+				t.Error("no message ID")
+			}
+			chunks[seq] = p[12:]
+			if seq < count-1 {
+				continue
+			}
+			p = bytes.Join(chunks, nil)
+		}
+		var r io.Reader = bytes.NewReader(p)
+		switch {
+		case p[0] == 0x1f && p[1] == 0x8b:
+			r, err = gzip.NewReader(r)
+		case p[0] == 0x78:
+			r, err = zlib.NewReader(r)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = json.NewDecoder(r).Decode(&m); err != nil {
+			t.Fatal(err)
+		}
+		return m, chunked
+	}
+}
+
+func TestGelfUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer pc.Close()
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	for _, compress := range []string{"gzip", "zlib", "none"} {
+		l := createGelfLogger(map[string]interface{}{
+			"addr": pc.LocalAddr().String(), "host": "web1", "compress": compress, "chunkSize": 200,
+			"staticFields": []Field{String("env", "prod")},
+		})
+		l.Warn("short")
+		m, chunked := readGelf(t, pc)
+		if chunked != 0 || m["short_message"] != "short" || m["host"] != "web1" || m["level"] != 4.0 || m["_env"] != "prod" {
+			t.Errorf("%s: got %v", compress, m)
+		}
+		// several chunks even compressed
+		var sb strings.Builder
+		for i, x := 0, uint32(1); i < 500; i++ {
+			x = x*1664525 + 1013904223
+			sb.WriteString(strconv.FormatUint(uint64(x>>16), 36))
+		}
+		long := sb.String()
+		l.Logw(InfoLevel, long, []Field{Int("n", 1)})
+		if m, chunked = readGelf(t, pc); chunked < 2 || m["short_message"] != long || m["_n"] != 1.0 {
+			t.Errorf("%s: got %d chunks of a %d byte message", compress, chunked, len(long))
+		}
+		l.Close()
+	}
+}
+
+func TestGelfTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer ln.Close()
+	conns := accept(ln)
+	l := createGelfLogger(map[string]interface{}{"network": "tcp", "addr": ln.Addr().String()})
+	defer l.Close()
+	l.Info("one")
+	l.Info("two")
+	r := bufio.NewReader(<-conns)
+	for _, want := range []string{"one", "two"} {
+		p, err := r.ReadBytes(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var m map[string]interface{}
+		if err = json.Unmarshal(p[:len(p)-1], &m); err != nil || m["short_message"] != want || m["host"] != host {
+			t.Errorf("got %s, %v", p, err)
+		}
+	}
+}
@@ -0,0 +1,346 @@
+package glog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// httpBatch is a request body in the making: the entries, separated by
+// commas for a JSON array or ending in newlines for NDJSON.
+type httpBatch struct {
+	body []byte
+	n    int
+}
+
+// httpWriter posts entries in batches, up to batchSize entries or
+// batchBytes, and at least every flushInterval. The batches are sent by
+// a goroutine of their own, so logging never waits for the server; those
+// waiting are kept up to limit bytes, the oldest dropped beyond.
+type httpWriter struct {
+	mu         sync.Mutex
+	cond       *sync.Cond
+	url        string
+	ndjson     bool
+	gzip       bool
+	header     http.Header
+	client     *http.Client
+	batchSize  int
+	batchBytes int
+	limit      int
+	retries    int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+	onError    func(error)
+
+	cur     httpBatch
+	queue   []httpBatch
+	queued  int  // bytes in queue
+	busy    bool // a batch is being sent
+	dropped int  // entries dropped since the last error
+	closed  bool
+	stop    chan struct{}
+}
+
+func (w *httpWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if len(p) > 0 && p[len(p)-1] == '\n' {
+		p = p[:len(p)-1]
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, fmt.Errorf("glog: http %s closed", w.url)
+	}
+	if w.ndjson {
+		w.cur.body = append(append(w.cur.body, p...), '\n')
+	} else {
+		if w.cur.n > 0 {
+			w.cur.body = append(w.cur.body, ',')
+		}
+		w.cur.body = append(w.cur.body, p...)
+	}
+	w.cur.n++
+	if w.cur.n >= w.batchSize || len(w.cur.body) >= w.batchBytes {
+		w.enqueue()
+	}
+	if w.dropped > 0 {
+		err := fmt.Errorf("glog: http %s behind, %d entries dropped", w.url, w.dropped)
+		w.dropped = 0
+		return n, err
+	}
+	return n, nil
+}
+
+// enqueue hands the current batch to the sender. It is called with mu
+// held.
+func (w *httpWriter) enqueue() {
+	if w.cur.n == 0 {
+		return
+	}
+	w.queue = append(w.queue, w.cur)
+	w.queued += len(w.cur.body)
+	w.cur = httpBatch{}
+	for w.queued > w.limit && len(w.queue) > 1 {
+		w.queued -= len(w.queue[0].body)
+		w.dropped += w.queue[0].n
+		w.queue[0] = httpBatch{}
+		w.queue = w.queue[1:]
+	}
+	w.cond.Broadcast()
+}
+
+func (w *httpWriter) sendRoutine() {
+	w.mu.Lock()
+	for {
+		for len(w.queue) == 0 && !w.closed {
+			w.cond.Wait()
+		}
+		if len(w.queue) == 0 {
+			w.mu.Unlock()
+			return
+		}
+		b := w.queue[0]
+		w.queue[0] = httpBatch{}
+		w.queue = w.queue[1:]
+		w.queued -= len(b.body)
+		w.busy = true
+		w.mu.Unlock()
+
+		err := w.post(b)
+		if err != nil && w.onError != nil {
+			w.onError(err)
+		}
+
+		w.mu.Lock()
+		w.busy = false
+		w.cond.Broadcast()
+	}
+}
+
+// post sends a batch, trying again with backoff and jitter after network
+// errors, 5xx and 429.
+func (w *httpWriter) post(b httpBatch) error {
+	body := b.body
+	if !w.ndjson {
+		body = append(append([]byte{'['}, body...), ']')
+	}
+	if w.gzip {
+		var zbuf bytes.Buffer
+		zw := gzip.NewWriter(&zbuf)
+		zw.Write(body)
+		zw.Close()
+		body = zbuf.Bytes()
+	}
+
+	backoff := w.minBackoff
+	for attempt := 0; ; attempt++ {
+		retry, wait, err := w.do(body)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= w.retries {
+			return fmt.Errorf("glog: http %s, %d entries dropped: %v", w.url, b.n, err)
+		}
+		// full jitter in the upper half, so the retries of several
+		// processes spread out
+		d := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		if wait > d {
+			d = wait
+		}
+		if d > w.maxBackoff {
+			d = w.maxBackoff
+		}
+		time.Sleep(d)
+		if backoff *= 2; backoff > w.maxBackoff {
+			backoff = w.maxBackoff
+		}
+	}
+}
+
+// do makes one request. It reports whether to try again, and for how long
+// the server asked to wait.
+func (w *httpWriter) do(body []byte) (retry bool, wait time.Duration, err error) {
+	req, err := http.NewRequest("POST", w.url, bytes.NewReader(body))
+	if err != nil {
+		return false, 0, err
+	}
+	for k, v := range w.header {
+		req.Header[k] = v
+	}
+	if w.ndjson {
+		req.Header.Set("Content-Type", "application/x-ndjson")
+	} else {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if w.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, 0, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode < 300 {
+		return false, 0, nil
+	}
+	if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		wait = time.Duration(s) * time.Second
+	}
+	retry = resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, wait, fmt.Errorf("%s", resp.Status)
+}
+
+func (w *httpWriter) flushRoutine(interval time.Duration) {
+	tk := time.NewTicker(interval)
+	defer tk.Stop()
+	for {
+		select {
+		case <-tk.C:
+			w.mu.Lock()
+			w.enqueue()
+			w.mu.Unlock()
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// Flush sends the current batch and waits until all are sent, or
+// dropped.
+func (w *httpWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.enqueue()
+	for len(w.queue) > 0 || w.busy {
+		w.cond.Wait()
+	}
+	return nil
+}
+
+// Close sends what is left, retries included, and ends the goroutines.
+func (w *httpWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.enqueue()
+	w.cond.Broadcast()
+	for len(w.queue) > 0 || w.busy {
+		w.cond.Wait()
+	}
+	w.mu.Unlock()
+	close(w.stop)
+	return nil
+}
+
+// createHTTPLogger returns a Logger posting its entries in batches to an
+// HTTP endpoint, as JSON.
+//
+// options:
+//
+//	url: string, where to post
+//	format: string, "json" (default) posts a JSON array of entries,
+//	        "ndjson" one entry per line
+//	gzip: bool, compress the requests
+//	headers: map[string]string, more request headers, such as
+//	         Authorization
+//	client: *http.Client, one with a 10s timeout by default
+//	batchSize: int, the most entries of a request, 100 by default
+//	batchBytes: int, a batch is sent once this large, 1MB by default
+//	flushInterval: time.Duration, the longest a batch waits, 1s by default
+//	retries: int, how often a request is tried again after network
+//	         errors, timeouts, 5xx and 429, 3 by default
+//	backoff: time.Duration, the wait before the first retry, 100ms by
+//	         default, doubled for each one and jittered
+//	maxBackoff: time.Duration, 10s by default
+//	pendingBytes: int, how much may wait to be sent, 8MB by default; the
+//	              oldest batches are dropped beyond it
+//	and the Logger options, see setOptions, but encoding and buffered
+func createHTTPLogger(options map[string]interface{}) *Logger {
+	w := &httpWriter{
+		batchSize:  100,
+		batchBytes: 1 << 20,
+		limit:      8 << 20,
+		retries:    3,
+		minBackoff: 100 * time.Millisecond,
+		maxBackoff: 10 * time.Second,
+		header:     make(http.Header),
+		client:     &http.Client{Timeout: 10 * time.Second},
+		stop:       make(chan struct{}),
+	}
+	w.cond = sync.NewCond(&w.mu)
+	if w.url, _ = options["url"].(string); w.url == "" {
+		log.Printf("http url [] invalid, entries will be dropped\n")
+	}
+	if s, ok := options["format"].(string); ok {
+		switch s {
+		case "json":
+		case "ndjson":
+			w.ndjson = true
+		default:
+			log.Printf("http format [%s] invalid, must be json or ndjson, set to json\n", s)
+		}
+	}
+	w.gzip, _ = options["gzip"].(bool)
+	if m, ok := options["headers"].(map[string]string); ok {
+		for k, v := range m {
+			w.header.Set(k, v)
+		}
+	}
+	if c, ok := options["client"].(*http.Client); ok && c != nil {
+		w.client = c
+	}
+	if n, ok := options["batchSize"].(int); ok && n > 0 {
+		w.batchSize = n
+	}
+	if n, ok := options["batchBytes"].(int); ok && n > 0 {
+		w.batchBytes = n
+	}
+	if n, ok := options["pendingBytes"].(int); ok && n > 0 {
+		w.limit = n
+	}
+	if n, ok := options["retries"].(int); ok && n >= 0 {
+		w.retries = n
+	}
+	if d, ok := options["backoff"].(time.Duration); ok && d > 0 {
+		w.minBackoff = d
+	}
+	if d, ok := options["maxBackoff"].(time.Duration); ok && d > 0 {
+		w.maxBackoff = d
+	}
+	if w.maxBackoff < w.minBackoff {
+		w.maxBackoff = w.minBackoff
+	}
+
+	flag, _ := options["flag"].(int)
+	l := &Logger{flag: int32(flag)}
+	l.prefix.Store(prefixFn)
+	l.out.out = make(map[int]io.WriteCloser)
+	for i := DebugLevel; i < LevelCount; i++ {
+		l.out.out[i] = w
+	}
+	// the entries go in JSON arrays, they must be JSON themselves
+	o := withoutOptions(options, "buffered", "encoder", "levelEncoding")
+	o["encoding"] = "json"
+	l.setOptions(o)
+	w.onError = l.onError
+
+	interval, ok := options["flushInterval"].(time.Duration)
+	if !ok || interval <= 0 {
+		interval = time.Second
+	}
+	go w.sendRoutine()
+	go w.flushRoutine(interval)
+	return l
+}
@@ -0,0 +1,155 @@
+package glog
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHTTPSink(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		bodies [][]map[string]interface{}
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "gzip" || r.Header.Get("Content-Type") != "application/x-ndjson" ||
+			r.Header.Get("X-Token") != "secret" {
+			t.Errorf("headers %v", r.Header)
+		}
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		var entries []map[string]interface{}
+		for s := bufio.NewScanner(zr); s.Scan(); {
+			var e map[string]interface{}
+			if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+				t.Error(err)
+			}
+			entries = append(entries, e)
+		}
+		mu.Lock()
+		bodies = append(bodies, entries)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	l := createHTTPLogger(map[string]interface{}{
+		"url": srv.URL, "format": "ndjson", "gzip": true, "headers": map[string]string{"X-Token": "secret"},
+		"batchSize": 2, "flushInterval": time.Hour,
+	})
+	l.Info("one")
+	l.Logw(WarnLevel, "two", []Field{Int("n", 2)})
+	l.Error("three")
+	l.Close()
+	if len(bodies) != 2 || len(bodies[0]) != 2 || len(bodies[1]) != 1 {
+		t.Fatalf("got %v", bodies)
+	}
+	if e := bodies[0][1]; e["msg"] != "two" || e["level"] != "WARN" || e["n"] != 2.0 {
+		t.Errorf("got %v", e)
+	}
+	if bodies[1][0]["msg"] != "three" {
+		t.Errorf("got %v", bodies[1])
+	}
+}
+
+func TestHTTPSinkRetry(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		attempts int
+		got      []map[string]interface{}
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		switch {
+		case strings.Contains(r.URL.Path, "bad"):
+			w.WriteHeader(http.StatusBadRequest)
+		case attempts < 3:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			if r.Header.Get("Content-Type") != "application/json" {
+				t.Errorf("Content-Type %s", r.Header.Get("Content-Type"))
+			}
+			json.NewDecoder(r.Body).Decode(&got)
+		}
+	}))
+	defer srv.Close()
+
+	// 5xx is tried again
+	l := createHTTPLogger(map[string]interface{}{"url": srv.URL, "backoff": time.Millisecond})
+	l.Info("one")
+	l.Info("two")
+	l.Flush()
+	mu.Lock()
+	if attempts != 3 || len(got) != 2 || got[0]["msg"] != "one" || got[1]["msg"] != "two" {
+		t.Errorf("%d attempts, got %v", attempts, got)
+	}
+	mu.Unlock()
+	l.Close()
+
+	// other 4xx is not, the batch is dropped and reported
+	mu.Lock()
+	attempts = 0
+	mu.Unlock()
+	errs := make(chan error, 1)
+	l = createHTTPLogger(map[string]interface{}{
+		"url": srv.URL + "/bad", "backoff": time.Millisecond,
+		"onError": func(err error) { errs <- err },
+	})
+	l.Info("one")
+	l.Close()
+	mu.Lock()
+	defer mu.Unlock()
+	if err := <-errs; attempts != 1 || !strings.Contains(err.Error(), "1 entries dropped: 400") {
+		t.Errorf("%d attempts, %v", attempts, err)
+	}
+}
+
+func TestHTTPSinkBounded(t *testing.T) {
+	gate := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-gate
+		io.Copy(io.Discard, r.Body)
+	}))
+	defer srv.Close()
+
+	var errs []error
+	l := createHTTPLogger(map[string]interface{}{
+		"url": srv.URL, "batchSize": 1, "pendingBytes": 200, "flushInterval": time.Hour,
+		"prefix": map[int]string{}, "onError": func(err error) { errs = append(errs, err) },
+	})
+	// the first batch is held by the server, the others wait within
+	// pendingBytes
+	l.Info("first")
+	w := l.out.out[InfoLevel].(*httpWriter)
+	for {
+		w.mu.Lock()
+		busy := w.busy
+		w.mu.Unlock()
+		if busy {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for i := 0; i < 10; i++ {
+		l.Info("%s", strings.Repeat("x", 50))
+	}
+	w.mu.Lock()
+	queued := w.queued
+	w.mu.Unlock()
+	if queued > 200 || len(errs) == 0 || !strings.Contains(errs[0].Error(), "entries dropped") {
+		t.Errorf("%d bytes queued, errors %v", queued, errs)
+	}
+	close(gate)
+	l.Close()
+}
@@ -0,0 +1,33 @@
+package glog
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"strconv"
+	"time"
+)
+
+var (
+	// instanceID tells apart the runs of a program, see InstanceID.
+	instanceID = newInstanceID()
+	// sequence is the number of the last entry with Lsequence, shared by
+	// all loggers of the process so that level files can be merged.
+	sequence uint64
+)
+
+// InstanceID returns the random ID of the running process as written by
+// Linstance. It is generated at start up, a restart of the same program
+// with the same pid gets a new one.
+func InstanceID() string {
+	return instanceID
+}
+
+func newInstanceID() string {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		// no entropy, the start time and pid are unique enough
+		return strconv.FormatInt(time.Now().UnixNano(), 16) + "-" + strconv.Itoa(os.Getpid())
+	}
+	return hex.EncodeToString(b[:])
+}
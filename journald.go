@@ -0,0 +1,176 @@
+package glog
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// journalSocket is where journald takes entries in its native protocol.
+const journalSocket = "/run/systemd/journal/socket"
+
+// journalEncoder writes entries in the native protocol of journald: one
+// datagram of KEY=value lines, values with newlines as the key, a newline,
+// the length as 64 bit little endian and the value. Fields become journal
+// fields with their keys in upper case.
+type journalEncoder struct {
+	identifier string
+	redact     *redactor // for the values nested in object and array fields
+}
+
+func (je journalEncoder) Encode(buf []byte, flag int, e *Entry) []byte {
+	buf = appendJournalField(buf, "MESSAGE", strings.TrimSuffix(e.Message, "\n"))
+	buf = append(buf, "PRIORITY="...)
+	buf = strconv.AppendInt(buf, int64(syslogSeverity[e.Level]), 10)
+	buf = append(buf, '\n')
+	buf = appendJournalField(buf, "SYSLOG_IDENTIFIER", je.identifier)
+	if e.File != "" {
+		buf = appendJournalField(buf, "CODE_FILE", e.File)
+		buf = append(buf, "CODE_LINE="...)
+		buf = strconv.AppendInt(buf, int64(e.Line), 10)
+		buf = append(buf, '\n')
+		if fn := runtime.FuncForPC(e.pc); fn != nil {
+			buf = appendJournalField(buf, "CODE_FUNC", fn.Name())
+		}
+	}
+	if flag&Linstance != 0 {
+		buf = appendJournalField(buf, "GLOG_INSTANCE", instanceID)
+	}
+	if flag&Lsequence != 0 {
+		buf = append(buf, "GLOG_SEQ="...)
+		buf = strconv.AppendUint(buf, e.Seq, 10)
+		buf = append(buf, '\n')
+	}
+
+	tmp := getBuffer()
+	for i := range e.Fields {
+		f := &e.Fields[i]
+		tmp.out = appendJournalName(tmp.out[:0], f.Key)
+		if len(tmp.out) == 0 {
+			continue
+		}
+		if f.typ == objectType || f.typ == arrayType {
+			tmp.msg, _ = appendTextValue(tmp.msg[:0], *f, je.redact)
+		} else {
+			tmp.msg = f.appendText(tmp.msg[:0])
+		}
+		buf = appendJournalField(buf, string(tmp.out), tmp.message())
+	}
+	putBuffer(tmp)
+	return buf
+}
+
+func appendJournalField(buf []byte, name, value string) []byte {
+	buf = append(buf, name...)
+	if strings.IndexByte(value, '\n') < 0 {
+		buf = append(buf, '=')
+		buf = append(buf, value...)
+		return append(buf, '\n')
+	}
+	buf = append(buf, '\n')
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(len(value)))
+	buf = append(buf, value...)
+	return append(buf, '\n')
+}
+
+// appendJournalName appends key as a journal field name: upper case
+// letters, digits and underscores, not starting with an underscore, which
+// marks the fields journald sets itself, or a digit.
+func appendJournalName(buf []byte, key string) []byte {
+	key = strings.TrimLeft(key, "_")
+	if key != "" && key[0] >= '0' && key[0] <= '9' {
+		buf = append(buf, 'F', '_')
+	}
+	for i := 0; i < len(key) && len(buf) < 64; i++ {
+		c := key[i]
+		switch {
+		case c >= 'a' && c <= 'z':
+			c -= 'a' - 'A'
+		case c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		default:
+			c = '_'
+		}
+		buf = append(buf, c)
+	}
+	return buf
+}
+
+// journalWriter sends each entry as a datagram to journald. Entries too
+// large for a datagram go in a sealed memory file whose descriptor is
+// sent instead, see sendLarge.
+type journalWriter struct {
+	path string
+	conn *net.UnixConn
+}
+
+func (w *journalWriter) Write(p []byte) (int, error) {
+	var err error
+	for try := 0; try < 2; try++ {
+		if w.conn == nil {
+			if w.conn, err = net.DialUnix("unixgram", nil, &net.UnixAddr{Name: w.path, Net: "unixgram"}); err != nil {
+				w.conn = nil
+				continue
+			}
+		}
+		if _, err = w.conn.Write(p); err == nil {
+			return len(p), nil
+		}
+		if isTooLarge(err) {
+			if err = sendLarge(w.conn, p); err != nil {
+				return 0, err
+			}
+			return len(p), nil
+		}
+		w.conn.Close()
+		w.conn = nil
+	}
+	return 0, err
+}
+
+func (w *journalWriter) Close() error {
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+// createJournaldLogger returns a Logger sending its entries to journald.
+//
+// options:
+//
+//	socket: string, the journald socket, /run/systemd/journal/socket
+//	identifier: string, SYSLOG_IDENTIFIER, the program name by default
+//	flag: int, Lshortfile or Llongfile add CODE_FILE, CODE_LINE and
+//	      CODE_FUNC, Linstance and Lsequence GLOG_INSTANCE and GLOG_SEQ
+//	and the Logger options, see setOptions, but encoding and buffered
+func createJournaldLogger(options map[string]interface{}) *Logger {
+	je := journalEncoder{identifier: program}
+	if s, ok := options["identifier"].(string); ok && s != "" {
+		je.identifier = s
+	}
+	w := &journalWriter{path: journalSocket}
+	if s, ok := options["socket"].(string); ok && s != "" {
+		w.path = s
+	}
+
+	flag, ok := options["flag"].(int)
+	if !ok {
+		flag = Llongfile
+	}
+	l := &Logger{flag: int32(flag)}
+	l.prefix.Store(prefixFn)
+	l.out.out = make(map[int]io.WriteCloser)
+	for i := DebugLevel; i < LevelCount; i++ {
+		l.out.out[i] = w
+	}
+	l.setOptions(withoutOptions(options, "buffered"))
+	je.redact = l.redact
+	l.enc = je
+	l.levelEnc = nil
+	return l
+}
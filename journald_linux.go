@@ -0,0 +1,69 @@
+package glog
+
+import (
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	mfdCloexec       = 0x1
+	mfdAllowSealing  = 0x2
+	fAddSeals        = 1033
+	fSealSeal        = 0x1
+	fSealShrink      = 0x2
+	fSealGrow        = 0x4
+	fSealWrite       = 0x8
+	journalMemfdName = "glog-journal\x00"
+)
+
+func isTooLarge(err error) bool {
+	return errors.Is(err, syscall.EMSGSIZE) || errors.Is(err, syscall.ENOBUFS)
+}
+
+// sendLarge sends p to journald in a sealed memfd, or where there is no
+// memfd in an unlinked file in /dev/shm, as sd_journal_send does.
+func sendLarge(conn *net.UnixConn, p []byte) error {
+	f, err := memfd()
+	if err != nil {
+		if f, err = os.CreateTemp("/dev/shm", "glog-journal-"); err != nil {
+			return err
+		}
+		os.Remove(f.Name())
+	}
+	defer f.Close()
+
+	if _, err = f.Write(p); err != nil {
+		return err
+	}
+	// journald only takes memfds that can not change any more
+	syscall.Syscall(syscall.SYS_FCNTL, f.Fd(), fAddSeals, fSealSeal|fSealShrink|fSealGrow|fSealWrite)
+	// WriteMsgUnix refuses connected datagram sockets
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	rights := syscall.UnixRights(int(f.Fd()))
+	if werr := rc.Write(func(fd uintptr) bool {
+		err = syscall.Sendmsg(int(fd), nil, rights, nil, 0)
+		return err != syscall.EAGAIN
+	}); werr != nil {
+		return werr
+	}
+	return err
+}
+
+// memfd creates an anonymous memory file that can be sealed.
+func memfd() (*os.File, error) {
+	if sysMemfdCreate == 0 {
+		return nil, syscall.ENOSYS
+	}
+	name := []byte(journalMemfdName)
+	fd, _, errno := syscall.Syscall(sysMemfdCreate, uintptr(unsafe.Pointer(&name[0])), mfdCloexec|mfdAllowSealing, 0)
+	if errno != 0 {
+		return nil, errno
+	}
+	return os.NewFile(fd, "memfd:glog-journal"), nil
+}
@@ -0,0 +1,3 @@
+package glog
+
+const sysMemfdCreate = 279
@@ -0,0 +1,49 @@
+package glog
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestJournalLarge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "socket")
+	pc, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Skip(err)
+	}
+	defer pc.Close()
+	l := createJournaldLogger(map[string]interface{}{"socket": path})
+	defer l.Close()
+
+	// too large for a datagram: the entry comes as a file descriptor
+	msg := strings.Repeat("x", 1<<20)
+	l.Info("%s", msg)
+	oob := make([]byte, syscall.CmsgSpace(4))
+	_, oobn, _, _, err := pc.ReadMsgUnix(nil, oob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("control messages: %v, %v", msgs, err)
+	}
+	fds, err := syscall.ParseUnixRights(&msgs[0])
+	if err != nil || len(fds) != 1 {
+		t.Fatalf("fds: %v, %v", fds, err)
+	}
+	f := os.NewFile(uintptr(fds[0]), "journal")
+	defer f.Close()
+	if _, err = f.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 2<<20)
+	n, _ := io.ReadFull(f, data)
+	if got := parseJournal(t, data[:n]); got["MESSAGE"] != msg {
+		t.Errorf("got a message of %d bytes, want %d", len(got["MESSAGE"]), len(msg))
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package glog
+
+import (
+	"errors"
+	"net"
+)
+
+func isTooLarge(err error) bool { return false }
+
+func sendLarge(conn *net.UnixConn, p []byte) error {
+	return errors.New("glog: journald is only supported on linux")
+}
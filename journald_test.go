@@ -0,0 +1,98 @@
+package glog
+
+import (
+	"encoding/binary"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// parseJournal splits a native protocol datagram into its fields.
+func parseJournal(t *testing.T, p []byte) map[string]string {
+	fields := make(map[string]string)
+	for len(p) > 0 {
+		i := strings.IndexAny(string(p), "=\n")
+		if i < 0 {
+			t.Fatalf("unterminated field %q", p)
+		}
+		key := string(p[:i])
+		if p[i] == '=' {
+			j := strings.IndexByte(string(p), '\n')
+			fields[key] = string(p[i+1 : j])
+			p = p[j+1:]
+			continue
+		}
+		n := int(binary.LittleEndian.Uint64(p[i+1:]))
+		p = p[i+9:]
+		fields[key] = string(p[:n])
+		if p[n] != '\n' {
+			t.Fatalf("%s: no newline after %d bytes", key, n)
+		}
+		p = p[n+1:]
+	}
+	return fields
+}
+
+func TestJournalEncoder(t *testing.T) {
+	e := &Entry{
+		Level:   WarnLevel,
+		Time:    testTime,
+		Seq:     7,
+		File:    "/src/app/main.go",
+		Line:    42,
+		Message: "disk full\n",
+		Fields: []Field{
+			String("dev", "/dev/sda1"), Int("pct", 99),
+			String("trace", "line 1\nline 2"), String("_PID", "1"), String("2fa", "on"),
+		},
+	}
+	je := journalEncoder{identifier: "app"}
+	got := parseJournal(t, je.Encode(nil, Lsequence, e))
+	want := map[string]string{
+		"MESSAGE":           "disk full",
+		"PRIORITY":          "4",
+		"SYSLOG_IDENTIFIER": "app",
+		"CODE_FILE":         "/src/app/main.go",
+		"CODE_LINE":         "42",
+		"GLOG_SEQ":          "7",
+		"DEV":               "/dev/sda1",
+		"PCT":               "99",
+		"TRACE":             "line 1\nline 2",
+		"PID":               "1",
+		"F_2FA":             "on",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s: got %q, want %q", k, got[k], v)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %d fields, want %d: %q", len(got), len(want), got)
+	}
+}
+
+func TestJournalWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "socket")
+	pc, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Skip(err)
+	}
+	defer pc.Close()
+	l := createJournaldLogger(map[string]interface{}{"socket": path, "identifier": "app"})
+	defer l.Close()
+
+	l.Outputw(ErrorLevel, 1, "failed", []Field{String("err", "a\nb")})
+	buf := make([]byte, 4096)
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := parseJournal(t, buf[:n])
+	if f["MESSAGE"] != "failed" || f["PRIORITY"] != "3" || f["ERR"] != "a\nb" || f["SYSLOG_IDENTIFIER"] != "app" {
+		t.Errorf("got %q", f)
+	}
+	if !strings.HasSuffix(f["CODE_FILE"], "journald_test.go") || !strings.HasSuffix(f["CODE_FUNC"], ".TestJournalWriter") {
+		t.Errorf("caller: got %q, %q", f["CODE_FILE"], f["CODE_FUNC"])
+	}
+}
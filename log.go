@@ -1,222 +1,324 @@
-package glog
-
-import (
-	"fmt"
-	"log"
-)
-
-type logType int
-
-const (
-	DEV logType = iota
-	PRO
-	LOGNOTHING
-)
-const (
-	DebugLevel = iota
-	InfoLevel
-	WarnLevel
-	ErrorLevel
-	FatalLevel
-	PanicLevel
-	LevelCount
-)
-
-var (
-	_              = fmt.Printf
-	_logger logger = &console{}
-)
-
-type logger interface {
-	Debug(format string, v ...interface{})
-	Info(format string, v ...interface{})
-	Warn(format string, v ...interface{})
-	Error(format string, v ...interface{})
-	Fatal(format string, v ...interface{})
-	Panic(format string, v ...interface{})
-	Flush()
-
-	GetPrefix() map[int]string
-	Prefix(lv int) string
-	SetPrefix(lv int, prefix string)
-	Flags() int
-	SetFlags(flag int)
-	Close()
-	Level() int
-	SetLevel(int)
-}
-
-func InitLogger(typ logType, options map[string]interface{}) {
-	prefixesMap := map[int]string{
-		DebugLevel: "DEBUG",
-		InfoLevel:  "INFO",
-		WarnLevel:  "WARN",
-		ErrorLevel: "ERROR",
-		FatalLevel: "FATAL",
-		PanicLevel: "PANIC",
-	}
-
-	if typ == DEV {
-		_logger = &console{
-			prefixes: prefixesMap,
-		}
-		log.SetFlags(log.LstdFlags)
-	} else if typ == LOGNOTHING {
-		_logger = nullLog{}
-		log.SetFlags(log.LstdFlags)
-	} else {
-		if options == nil {
-			_logger = &console{}
-			log.SetFlags(log.LstdFlags)
-			return
-		}
-		switch options["typ"].(string) {
-		case "file":
-			if options["prefix"] == nil {
-				options["prefix"] = prefixesMap
-			}
-			_logger = createFileLogger(options)
-		//case "nsq":
-		//	_logger = createNsqLogger(options)
-		default:
-			_logger = &console{}
-			log.SetFlags(log.LstdFlags)
-		}
-	}
-}
-
-func Close() {
-	_logger.Close()
-}
-
-func Flags() int {
-	return _logger.Flags()
-}
-
-func Level() int {
-	return _logger.Level()
-}
-
-func SetLevel(lv int) {
-	_logger.SetLevel(lv)
-}
-
-func SetFlags(flag int) {
-	_logger.SetFlags(flag)
-}
-
-// GetPrefix returns the output prefix
-func GetPrefix() map[int]string {
-	return _logger.GetPrefix()
-}
-
-// Prefix returns the output prefix for the standard logger.
-func Prefix(lv int) string {
-	return _logger.Prefix(lv)
-}
-
-// SetPrefix sets the output prefix for the standard logger.
-func SetPrefix(lv int, prefix string) {
-	_logger.SetPrefix(lv, prefix)
-}
-
-func Debug(format string, v ...interface{}) {
-	if DebugLevel >= Level() {
-		_logger.Debug(format, v...)
-	}
-}
-
-func Info(format string, v ...interface{}) {
-	level := Level()
-	if InfoLevel >= level {
-		_logger.Info(format, v...)
-	}
-}
-
-func Warn(format string, v ...interface{}) {
-	if WarnLevel >= Level() {
-		_logger.Warn(format, v...)
-	}
-}
-
-func Error(format string, v ...interface{}) {
-	if ErrorLevel >= Level() {
-		_logger.Error(format, v...)
-	}
-}
-
-func Fatal(format string, v ...interface{}) {
-	if FatalLevel >= Level() {
-		_logger.Fatal(format, v...)
-	}
-}
-
-func Panic(format string, v ...interface{}) {
-	if PanicLevel >= Level() {
-		_logger.Panic(format, v...)
-	}
-}
-
-// 为了简单，这里修改prefix时就不加锁了
-type console struct {
-	prefixes map[int]string
-	level    int
-}
-
-func (c *console) GetPrefix() map[int]string {
-	return c.prefixes
-}
-
-func (c *console) Prefix(lv int) string {
-	return c.prefixes[lv]
-}
-
-func (c *console) SetPrefix(lv int, prefix string) {
-	c.prefixes[lv] = prefix
-}
-
-func (c *console) Flags() int {
-	return log.Flags()
-}
-
-func (c *console) SetFlags(flag int) {
-	log.SetFlags(flag)
-}
-
-func (c *console) Level() int {
-	return c.level
-}
-
-func (c *console) SetLevel(level int) {
-	c.level = level
-}
-
-func (c *console) Debug(format string, v ...interface{}) {
-	log.Printf(c.prefixes[DebugLevel]+" "+format, v...)
-}
-
-func (c *console) Info(format string, v ...interface{}) {
-	log.Printf(c.prefixes[InfoLevel]+" "+format, v...)
-}
-
-func (c *console) Warn(format string, v ...interface{}) {
-	log.Printf(c.prefixes[WarnLevel]+" "+format, v...)
-}
-
-func (c *console) Error(format string, v ...interface{}) {
-	log.Printf(c.prefixes[ErrorLevel]+" "+format, v...)
-}
-
-func (c *console) Fatal(format string, v ...interface{}) {
-	log.Fatalf(c.prefixes[FatalLevel]+" "+format, v...)
-}
-
-func (c *console) Panic(format string, v ...interface{}) {
-	log.Panicf(c.prefixes[PanicLevel]+" "+format, v...)
-}
-
-func (c *console) Close() {
-}
-
-func (c *console) Flush() {
-}
+package glog
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+type logType int
+
+const (
+	DEV logType = iota
+	PRO
+	LOGNOTHING
+)
+const (
+	DebugLevel = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+	FatalLevel
+	PanicLevel
+	LevelCount
+)
+
+var (
+	_              = fmt.Printf
+	_logger logger = &console{}
+
+	// consoleLog is where the console backend writes, and the code holding
+	// a Logger's lock reports its errors. It is not the standard logger,
+	// which RedirectStdLog may send back to glog.
+	consoleLog = log.New(os.Stderr, "", log.LstdFlags)
+)
+
+type logger interface {
+	Debug(format string, v ...interface{})
+	Info(format string, v ...interface{})
+	Warn(format string, v ...interface{})
+	Error(format string, v ...interface{})
+	Fatal(format string, v ...interface{})
+	Panic(format string, v ...interface{})
+	Logw(lv int, msg string, fields []Field)
+	// logpc logs an entry made elsewhere, by slog: the caller is given as
+	// a program counter, t is the time unless it is zero
+	logpc(lv int, pc uintptr, t time.Time, msg string, fields []Field)
+	Flush()
+
+	GetPrefix() map[int]string
+	Prefix(lv int) string
+	SetPrefix(lv int, prefix string)
+	Flags() int
+	SetFlags(flag int)
+	Close()
+	Level() int
+	SetLevel(int)
+}
+
+func InitLogger(typ logType, options map[string]interface{}) {
+	prefixesMap := map[int]string{
+		DebugLevel: "DEBUG",
+		InfoLevel:  "INFO",
+		WarnLevel:  "WARN",
+		ErrorLevel: "ERROR",
+		FatalLevel: "FATAL",
+		PanicLevel: "PANIC",
+	}
+
+	if typ == DEV {
+		_logger = &console{
+			prefixes: prefixesMap,
+		}
+		consoleLog.SetFlags(log.LstdFlags)
+	} else if typ == LOGNOTHING {
+		_logger = nullLog{}
+		consoleLog.SetFlags(log.LstdFlags)
+	} else {
+		if options == nil {
+			_logger = &console{}
+			consoleLog.SetFlags(log.LstdFlags)
+			return
+		}
+		switch options["typ"].(string) {
+		case "file":
+			if options["prefix"] == nil {
+				options["prefix"] = prefixesMap
+			}
+			_logger = createFileLogger(options)
+		case "console":
+			_logger = createConsoleLogger(options)
+		case "ring":
+			_logger = createRingLogger(options)
+		case "syslog":
+			_logger = createSyslogLogger(options)
+		case "journald":
+			_logger = createJournaldLogger(options)
+		case "net":
+			_logger = createNetLogger(options)
+		case "gelf":
+			_logger = createGelfLogger(options)
+		case "fluentd":
+			_logger = createFluentdLogger(options)
+		case "slog":
+			_logger = createSlogLogger(options)
+		case "tee":
+			if options["prefix"] == nil {
+				options["prefix"] = prefixesMap
+			}
+			_logger = createTeeLogger(options)
+		case "nsq":
+			_logger = createNsqLogger(options)
+		case "http":
+			_logger = createHTTPLogger(options)
+		default:
+			_logger = &console{}
+			consoleLog.SetFlags(log.LstdFlags)
+		}
+	}
+}
+
+func Close() {
+	_logger.Close()
+}
+
+func Flags() int {
+	return _logger.Flags()
+}
+
+func Level() int {
+	return _logger.Level()
+}
+
+func SetLevel(lv int) {
+	_logger.SetLevel(lv)
+}
+
+func SetFlags(flag int) {
+	_logger.SetFlags(flag)
+}
+
+// GetStats returns the counters of the standard logger, the zero Stats if
+// it does not keep any.
+func GetStats() Stats {
+	if s, ok := _logger.(interface {
+		Stats() Stats
+	}); ok {
+		return s.Stats()
+	}
+	return Stats{}
+}
+
+// GetPrefix returns the output prefix
+func GetPrefix() map[int]string {
+	return _logger.GetPrefix()
+}
+
+// Prefix returns the output prefix for the standard logger.
+func Prefix(lv int) string {
+	return _logger.Prefix(lv)
+}
+
+// SetPrefix sets the output prefix for the standard logger.
+func SetPrefix(lv int, prefix string) {
+	_logger.SetPrefix(lv, prefix)
+}
+
+func Debug(format string, v ...interface{}) {
+	if DebugLevel >= Level() {
+		_logger.Debug(format, v...)
+	}
+}
+
+func Info(format string, v ...interface{}) {
+	level := Level()
+	if InfoLevel >= level {
+		_logger.Info(format, v...)
+	}
+}
+
+func Warn(format string, v ...interface{}) {
+	if WarnLevel >= Level() {
+		_logger.Warn(format, v...)
+	}
+}
+
+func Error(format string, v ...interface{}) {
+	if ErrorLevel >= Level() {
+		_logger.Error(format, v...)
+	}
+}
+
+func Fatal(format string, v ...interface{}) {
+	if FatalLevel >= Level() {
+		_logger.Fatal(format, v...)
+	}
+}
+
+func Panic(format string, v ...interface{}) {
+	if PanicLevel >= Level() {
+		_logger.Panic(format, v...)
+	}
+}
+
+// Debugw logs msg with fields, see String, Int64 etc. for constructing them.
+func Debugw(msg string, fields ...Field) {
+	if DebugLevel >= Level() {
+		_logger.Logw(DebugLevel, msg, fields)
+	}
+}
+
+func Infow(msg string, fields ...Field) {
+	if InfoLevel >= Level() {
+		_logger.Logw(InfoLevel, msg, fields)
+	}
+}
+
+func Warnw(msg string, fields ...Field) {
+	if WarnLevel >= Level() {
+		_logger.Logw(WarnLevel, msg, fields)
+	}
+}
+
+func Errorw(msg string, fields ...Field) {
+	if ErrorLevel >= Level() {
+		_logger.Logw(ErrorLevel, msg, fields)
+	}
+}
+
+// Fatalw is Errorw at FatalLevel followed by a call to os.Exit(1).
+func Fatalw(msg string, fields ...Field) {
+	if FatalLevel >= Level() {
+		_logger.Logw(FatalLevel, msg, fields)
+	}
+	_logger.Flush()
+	os.Exit(1)
+}
+
+// Panicw is Errorw at PanicLevel followed by a call to panic(msg).
+func Panicw(msg string, fields ...Field) {
+	if PanicLevel >= Level() {
+		_logger.Logw(PanicLevel, msg, fields)
+	}
+	_logger.Flush()
+	panic(msg)
+}
+
+// 为了简单，这里修改prefix时就不加锁了
+type console struct {
+	prefixes map[int]string
+	level    int
+}
+
+func (c *console) GetPrefix() map[int]string {
+	return c.prefixes
+}
+
+func (c *console) Prefix(lv int) string {
+	return c.prefixes[lv]
+}
+
+func (c *console) SetPrefix(lv int, prefix string) {
+	c.prefixes[lv] = prefix
+}
+
+func (c *console) Flags() int {
+	return consoleLog.Flags()
+}
+
+func (c *console) SetFlags(flag int) {
+	// the standard log package has other meanings for these bits
+	consoleLog.SetFlags(flag &^ (Linstance | Lsequence))
+}
+
+func (c *console) Level() int {
+	return c.level
+}
+
+func (c *console) SetLevel(level int) {
+	c.level = level
+}
+
+func (c *console) Debug(format string, v ...interface{}) {
+	consoleLog.Printf(c.prefixes[DebugLevel]+" "+format, v...)
+}
+
+func (c *console) Info(format string, v ...interface{}) {
+	consoleLog.Printf(c.prefixes[InfoLevel]+" "+format, v...)
+}
+
+func (c *console) Warn(format string, v ...interface{}) {
+	consoleLog.Printf(c.prefixes[WarnLevel]+" "+format, v...)
+}
+
+func (c *console) Error(format string, v ...interface{}) {
+	consoleLog.Printf(c.prefixes[ErrorLevel]+" "+format, v...)
+}
+
+func (c *console) Fatal(format string, v ...interface{}) {
+	consoleLog.Fatalf(c.prefixes[FatalLevel]+" "+format, v...)
+}
+
+func (c *console) Panic(format string, v ...interface{}) {
+	consoleLog.Panicf(c.prefixes[PanicLevel]+" "+format, v...)
+}
+
+func (c *console) Logw(lv int, msg string, fields []Field) {
+	buf := []byte(c.prefixes[lv] + " " + strings.TrimSuffix(msg, "\n"))
+	consoleLog.Output(3, string(appendTextFields(buf, fields, nil)))
+}
+
+// logpc can not pass the caller to the standard log package, a caller
+// in the header is glog's.
+func (c *console) logpc(lv int, pc uintptr, t time.Time, msg string, fields []Field) {
+	buf := []byte(c.prefixes[lv] + " " + strings.TrimSuffix(msg, "\n"))
+	consoleLog.Output(2, string(appendTextFields(buf, fields, nil)))
+}
+
+func (c *console) Close() {
+}
+
+func (c *console) Flush() {
+}
@@ -1,287 +1,711 @@
-// Copyright 2009 The Go Authors. All rights reserved.
-// Use of this source code is governed by a BSD-style
-// license that can be found in the LICENSE file.
-
-// Package log implements a simple logging package. It defines a type, Logger,
-// with methods for formatting output. It also has a predefined 'standard'
-// Logger accessible through helper functions Print[f|ln], Fatal[f|ln], and
-// Panic[f|ln], which are easier to use than creating a Logger manually.
-// That logger writes to standard error and prints the date and time
-// of each logged message.
-// The Fatal functions call os.Exit(1) after writing the log message.
-// The Panic functions call panic after writing the log message.
-package glog
-
-import (
-	"fmt"
-	"io"
-	"os"
-	"runtime"
-	"sync"
-	"time"
-)
-
-// These flags define which text to prefix to each log entry generated by the Logger.
-const (
-	// Bits or'ed together to control what's printed. There is no control over the
-	// order they appear (the order listed here) or the format they present (as
-	// described in the comments).  A colon appears after these items:
-	//	2009/01/23 01:23:23.123123 /a/b/c/d.go:23: message
-	Ldate         = 1 << iota     // the date: 2009/01/23
-	Ltime                         // the time: 01:23:23
-	Lmicroseconds                 // microsecond resolution: 01:23:23.123123.  assumes Ltime.
-	Llongfile                     // full file name and line number: /a/b/c/d.go:23
-	Lshortfile                    // final file name element and line number: d.go:23. overrides Llongfile
-	LstdFlags     = Ldate | Ltime // initial values for the standard logger
-
-	maxCacheLength  = 8192
-	maxCacheSeconds = 2
-)
-
-type outputer struct {
-	prefix map[int]string
-	out    map[int]io.WriteCloser
-	// for performance
-	buf map[int][]byte
-}
-
-// A Logger represents an active logging object that generates lines of
-// output to an io.Writer.  Each logging operation makes a single call to
-// the Writer's Write method.  A Logger can be used simultaneously from
-// multiple goroutines; it guarantees to serialize access to the Writer.
-type Logger struct {
-	mu     sync.Mutex // ensures atomic writes; protects the following fields
-	flag   int        // properties
-	out    outputer   // destination for output
-	buf    []byte     // for accumulating text to write
-	items  int64
-	nbytes int64
-	level  int
-}
-
-// Cheap integer to fixed-width decimal ASCII.  Give a negative width to avoid zero-padding.
-// Knows the buffer has capacity.
-func itoa(buf *[]byte, i int, wid int) {
-	var u uint = uint(i)
-	if u == 0 && wid <= 1 {
-		*buf = append(*buf, '0')
-		return
-	}
-
-	// Assemble decimal in reverse order.
-	var b [32]byte
-	bp := len(b)
-	for ; u > 0 || wid > 0; u /= 10 {
-		bp--
-		wid--
-		b[bp] = byte(u%10) + '0'
-	}
-	*buf = append(*buf, b[bp:]...)
-}
-
-func (l *Logger) formatHeader(lv int, buf *[]byte, t time.Time, file string, line int) {
-	if l.flag&(Ldate|Ltime|Lmicroseconds) != 0 {
-		if l.flag&Ldate != 0 {
-			year, month, day := t.Date()
-			itoa(buf, year, 4)
-			*buf = append(*buf, '/')
-			itoa(buf, int(month), 2)
-			*buf = append(*buf, '/')
-			itoa(buf, day, 2)
-			*buf = append(*buf, ' ')
-		}
-		if l.flag&(Ltime|Lmicroseconds) != 0 {
-			hour, min, sec := t.Clock()
-			itoa(buf, hour, 2)
-			*buf = append(*buf, ':')
-			itoa(buf, min, 2)
-			*buf = append(*buf, ':')
-			itoa(buf, sec, 2)
-			if l.flag&Lmicroseconds != 0 {
-				*buf = append(*buf, '.')
-				itoa(buf, t.Nanosecond()/1e3, 6)
-			}
-			*buf = append(*buf, ' ')
-		}
-	}
-	if l.flag&(Lshortfile|Llongfile) != 0 {
-		if l.flag&Lshortfile != 0 {
-			short := file
-			for i := len(file) - 1; i > 0; i-- {
-				if file[i] == '/' {
-					short = file[i+1:]
-					break
-				}
-			}
-			file = short
-		}
-		*buf = append(*buf, file...)
-		*buf = append(*buf, ':')
-		itoa(buf, line, -1)
-		*buf = append(*buf, ": "...)
-	}
-	*buf = append(*buf, l.out.prefix[lv]...)
-	*buf = append(*buf, []byte(" ")...)
-}
-
-// Output writes the output for a logging event.  The string s contains
-// the text to print after the prefix specified by the flags of the
-// Logger.  A newline is appended if the last character of s is not
-// already a newline.  Calldepth is used to recover the PC and is
-// provided for generality, although at the moment on all pre-defined
-// paths it will be 2.
-func (l *Logger) Output(lv int, calldepth int, s string) error {
-	now := time.Now() // get this early.
-	var file string
-	var line int
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	if l.flag&(Lshortfile|Llongfile) != 0 {
-		// release lock while getting caller info - it's expensive.
-		l.mu.Unlock()
-		var ok bool
-		_, file, line, ok = runtime.Caller(calldepth)
-		if !ok {
-			file = "???"
-			line = 0
-		}
-		l.mu.Lock()
-	}
-
-	l.buf = l.buf[:0]
-	l.formatHeader(lv, &l.buf, now, file, line)
-	l.buf = append(l.buf, s...)
-	if len(s) > 0 && s[len(s)-1] != '\n' {
-		l.buf = append(l.buf, '\n')
-	}
-	l.items++
-	n, err := l.out.Write(lv, l.buf)
-	l.nbytes += int64(n)
-
-	return err
-}
-func (l *Logger) Level() int {
-	return l.level
-}
-
-func (l *Logger) SetLevel(level int) {
-	l.level = level
-}
-
-// Printf calls l.Output to print to the logger.
-// Arguments are handled in the manner of fmt.Printf.
-func (l *Logger) Debug(format string, v ...interface{}) {
-	if DebugLevel >= l.level {
-		l.Output(DebugLevel, 2, fmt.Sprintf(format, v...))
-	}
-}
-
-func (l *Logger) Info(format string, v ...interface{}) {
-	if InfoLevel >= l.level {
-		l.Output(InfoLevel, 2, fmt.Sprintf(format, v...))
-	}
-}
-
-func (l *Logger) Warn(format string, v ...interface{}) {
-	if WarnLevel >= l.level {
-		l.Output(WarnLevel, 2, fmt.Sprintf(format, v...))
-	}
-}
-
-func (l *Logger) Error(format string, v ...interface{}) {
-	if ErrorLevel >= l.level {
-		l.Output(ErrorLevel, 2, fmt.Sprintf(format, v...))
-	}
-}
-
-// Fatal is equivalent to l.Print() followed by a call to os.Exit(1).
-func (l *Logger) Fatal(format string, v ...interface{}) {
-	if FatalLevel >= l.level {
-		l.Output(FatalLevel, 2, fmt.Sprintf(format, v...))
-	}
-	os.Exit(1)
-}
-
-// Panicf is equivalent to l.Printf() followed by a call to panic().
-func (l *Logger) Panic(format string, v ...interface{}) {
-	s := fmt.Sprintf(format, v...)
-	if PanicLevel >= l.level {
-		l.Output(PanicLevel, 2, s)
-	}
-	panic(s)
-}
-
-// Flags returns the output flags for the logger.
-func (l *Logger) Flags() int {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	return l.flag
-}
-
-// SetFlags sets the output flags for the logger.
-func (l *Logger) SetFlags(flag int) {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	l.flag = flag
-}
-
-// GetPrefix returns the output prefix
-func (l *Logger) GetPrefix() map[int]string {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	return l.out.prefix
-}
-
-// Prefix returns the output prefix for the logger.
-func (l *Logger) Prefix(lv int) string {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	return l.out.prefix[lv]
-}
-
-// SetPrefix sets the output prefix for the logger.
-func (l *Logger) SetPrefix(lv int, prefix string) {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	l.out.prefix[lv] = prefix
-}
-
-func (o outputer) Write(lv int, buf []byte) (int, error) {
-	wr, ok := o.out[lv]
-	if !ok {
-		return 0, fmt.Errorf("No writer for level %d", lv)
-	}
-	return wr.Write(buf)
-}
-
-func (l *Logger) Close() {
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	for i := DebugLevel; i < LevelCount; i++ {
-		l.out.out[i].Close()
-	}
-}
-
-// 写入文件中
-func (l *Logger) Flush() {
-}
-
-func (l *Logger) flush() {
-	l.mu.Lock()
-	for lv, bf := range l.out.buf {
-		if len(bf) > 0 {
-			l.out.Write(lv, bf)
-		}
-	}
-	l.mu.Unlock()
-}
-
-func (l *Logger) flushRoutine() {
-	tk := time.NewTicker(time.Second * time.Duration(maxCacheSeconds))
-	for {
-		select {
-		case <-tk.C:
-			l.flush()
-		}
-	}
-}
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package log implements a simple logging package. It defines a type, Logger,
+// with methods for formatting output. It also has a predefined 'standard'
+// Logger accessible through helper functions Print[f|ln], Fatal[f|ln], and
+// Panic[f|ln], which are easier to use than creating a Logger manually.
+// That logger writes to standard error and prints the date and time
+// of each logged message.
+// The Fatal functions call os.Exit(1) after writing the log message.
+// The Panic functions call panic after writing the log message.
+package glog
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// These flags define which text to prefix to each log entry generated by the Logger.
+const (
+	// Bits or'ed together to control what's printed. There is no control over the
+	// order they appear (the order listed here) or the format they present (as
+	// described in the comments).  A colon appears after these items:
+	//	2009/01/23 01:23:23.123123 /a/b/c/d.go:23: message
+	Ldate         = 1 << iota     // the date: 2009/01/23
+	Ltime                         // the time: 01:23:23
+	Lmicroseconds                 // microsecond resolution: 01:23:23.123123.  assumes Ltime.
+	Llongfile                     // full file name and line number: /a/b/c/d.go:23
+	Lshortfile                    // final file name element and line number: d.go:23. overrides Llongfile
+	Linstance                     // the instance ID of the process: 9f86d081884c7d65, see InstanceID
+	Lsequence                     // the sequence number of the entry in the process: #42
+	LstdFlags     = Ldate | Ltime // initial values for the standard logger
+
+	maxCacheLength  = 8192
+	maxCacheSeconds = 2
+)
+
+type outputer struct {
+	out     map[int]io.WriteCloser // levels may share a writer
+	cascade bool                   // a level goes to the writers of the levels below too
+	// for performance: in buffered mode the pending output of each writer,
+	// written when it grows beyond limit or on flush
+	buf   map[io.WriteCloser][]byte
+	limit int
+}
+
+// A Logger represents an active logging object that generates lines of
+// output to an io.Writer.  Each logging operation makes a single call to
+// the Writer's Write method.  A Logger can be used simultaneously from
+// multiple goroutines; it guarantees to serialize access to the Writer.
+// Entries are formatted and encoded in pooled buffers without holding
+// the lock, only the final Write is serialized.
+type Logger struct {
+	mu        sync.Mutex // ensures atomic writes; protects the following fields
+	out       outputer   // destination for output
+	items     int64
+	nbytes    int64
+	truncated int64
+
+	flag     int32           // properties, accessed atomically
+	level    int32           // accessed atomically
+	prefix   atomic.Value    // map[int]string, replaced as a whole by SetPrefix
+	enc      Encoder         // nil means the text format of the standard log package
+	levelEnc map[int]Encoder // per level encoders, override enc
+
+	// message policies, set up by setOptions before the Logger is used
+	redact       *redactor
+	sanitize     bool // escape control characters and invalid UTF-8
+	keepNewlines bool // the encoder takes care of newlines itself
+	maxEntry     int  // longest message in bytes, 0 means no limit
+	maxField     int  // longest formatted argument in bytes, 0 means no limit
+	templates    bool // add the format and arguments as fields
+	onError      func(error)
+
+	// buffered mode, see setOptions
+	flushLevel    int           // entries at this level or above flush at once
+	flushInterval time.Duration // flushRoutine flushes this often
+	stop          chan struct{} // stops flushRoutine
+
+	async   *asyncQueue // async mode, see setOptions
+	dropped int64       // entries the async queue dropped, accessed atomically
+
+	sinks []sinkLogger // the loggers of a tee, which has no writers itself
+}
+
+// Stats are the counters kept by a Logger.
+type Stats struct {
+	Items     int64 // entries written
+	Bytes     int64 // bytes written
+	Truncated int64 // entries cut by the entry or field size limit
+	Dropped   int64 // entries dropped by a full async queue
+}
+
+// Cheap integer to fixed-width decimal ASCII.  Give a negative width to avoid zero-padding.
+// Knows the buffer has capacity.
+func itoa(buf *[]byte, i int, wid int) {
+	var u uint = uint(i)
+	if u == 0 && wid <= 1 {
+		*buf = append(*buf, '0')
+		return
+	}
+
+	// Assemble decimal in reverse order.
+	var b [32]byte
+	bp := len(b)
+	for ; u > 0 || wid > 0; u /= 10 {
+		bp--
+		wid--
+		b[bp] = byte(u%10) + '0'
+	}
+	*buf = append(*buf, b[bp:]...)
+}
+
+func formatHeader(buf *[]byte, flag int, e *Entry) {
+	t := e.Time
+	if flag&(Ldate|Ltime|Lmicroseconds) != 0 {
+		if flag&Ldate != 0 {
+			year, month, day := t.Date()
+			itoa(buf, year, 4)
+			*buf = append(*buf, '/')
+			itoa(buf, int(month), 2)
+			*buf = append(*buf, '/')
+			itoa(buf, day, 2)
+			*buf = append(*buf, ' ')
+		}
+		if flag&(Ltime|Lmicroseconds) != 0 {
+			hour, min, sec := t.Clock()
+			itoa(buf, hour, 2)
+			*buf = append(*buf, ':')
+			itoa(buf, min, 2)
+			*buf = append(*buf, ':')
+			itoa(buf, sec, 2)
+			if flag&Lmicroseconds != 0 {
+				*buf = append(*buf, '.')
+				itoa(buf, t.Nanosecond()/1e3, 6)
+			}
+			*buf = append(*buf, ' ')
+		}
+	}
+	if flag&Linstance != 0 {
+		*buf = append(*buf, instanceID...)
+		*buf = append(*buf, ' ')
+	}
+	if flag&Lsequence != 0 {
+		*buf = append(*buf, '#')
+		*buf = strconv.AppendUint(*buf, e.Seq, 10)
+		*buf = append(*buf, ' ')
+	}
+	if flag&(Lshortfile|Llongfile) != 0 {
+		*buf = append(*buf, callerFile(flag, e.File)...)
+		*buf = append(*buf, ':')
+		itoa(buf, e.Line, -1)
+		*buf = append(*buf, ": "...)
+	}
+}
+
+// callerFile returns file as the flags want it.
+func callerFile(flag int, file string) string {
+	if flag&Lshortfile != 0 {
+		for i := len(file) - 1; i > 0; i-- {
+			if file[i] == '/' {
+				return file[i+1:]
+			}
+		}
+	}
+	return file
+}
+
+// Output writes the output for a logging event.  The string s contains
+// the text to print after the prefix specified by the flags of the
+// Logger.  A newline is appended if the last character of s is not
+// already a newline.  Calldepth is used to recover the PC and is
+// provided for generality, although at the moment on all pre-defined
+// paths it will be 2.
+func (l *Logger) Output(lv int, calldepth int, s string) error {
+	b := getBuffer()
+	l.begin(b, lv, calldepth+1)
+	b.e.Message = s
+	return l.emit(b)
+}
+
+// Outputw is Output for a message with fields. Calldepth counts the
+// same way.
+func (l *Logger) Outputw(lv int, calldepth int, msg string, fields []Field) error {
+	b := getBuffer()
+	l.begin(b, lv, calldepth+1)
+	b.e.Message = msg
+	// copied, so that the caller's fields neither escape nor get changed
+	b.fields = append(b.fields[:0], fields...)
+	b.e.Fields = b.fields
+	return l.emit(b)
+}
+
+// outputf is Output for the leveled methods: the message is formatted
+// straight into the pooled buffer instead of going through fmt.Sprintf.
+func (l *Logger) outputf(lv int, calldepth int, format string, v []interface{}) error {
+	b := getBuffer()
+	l.begin(b, lv, calldepth+1)
+	l.formatf(b, format, v)
+	return l.emit(b)
+}
+
+// formatf formats the message of b, with the templates, log tags and
+// field size limit applied to v.
+func (l *Logger) formatf(b *buffer, format string, v []interface{}) {
+	if l.templates {
+		b.addTemplate(format, v)
+	}
+	v = l.marshalArgs(format, v)
+	if l.maxField > 0 {
+		v = l.limitArgs(b, format, v)
+	}
+	b.msg = fmt.Appendf(b.msg, format, v...)
+	b.e.Message = b.message()
+}
+
+// logpc is Outputw for entries that come with their caller and time.
+func (l *Logger) logpc(lv int, pc uintptr, t time.Time, msg string, fields []Field) {
+	if lv < l.Level() {
+		return
+	}
+	b := getBuffer()
+	l.begin(b, lv, -1)
+	if !t.IsZero() {
+		b.e.Time = t
+	}
+	if pc != 0 && l.Flags()&(Lshortfile|Llongfile) != 0 {
+		f, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+		b.e.pc, b.e.File, b.e.Line = pc, f.File, f.Line
+	}
+	b.e.Message = msg
+	b.fields = append(b.fields[:0], fields...)
+	b.e.Fields = b.fields
+	l.emit(b)
+}
+
+// begin fills in everything of the entry but its message. A negative
+// calldepth leaves the caller to the caller of begin.
+func (l *Logger) begin(b *buffer, lv int, calldepth int) {
+	e := &b.e
+	e.Time = time.Now() // get this early.
+	e.Level = lv
+	e.Prefix = l.prefixes()[lv]
+	flag := l.Flags()
+	if flag&Lsequence != 0 {
+		e.Seq = atomic.AddUint64(&sequence, 1)
+	}
+	if calldepth >= 0 && flag&(Lshortfile|Llongfile) != 0 {
+		var ok bool
+		e.pc, e.File, e.Line, ok = runtime.Caller(calldepth)
+		if !ok {
+			e.File = "???"
+			e.Line = 0
+		}
+	}
+}
+
+// emit encodes the entry outside the lock and writes it out. b is
+// returned to the pool.
+func (l *Logger) emit(b *buffer) error {
+	if l.sinks != nil {
+		return l.fanout(b)
+	}
+	l.process(b)
+	b.out = l.encoder(b.e.Level).Encode(b.out, l.Flags(), &b.e)
+	if l.async != nil && l.async.enqueue(l, b) {
+		return nil
+	}
+	return l.write(b)
+}
+
+// write writes the encoded entry in b.out and returns b to the pool.
+func (l *Logger) write(b *buffer) error {
+	l.mu.Lock()
+	l.items++
+	if b.truncated {
+		l.truncated++
+	}
+	n, err := l.out.Write(b.e.Level, b.out)
+	l.nbytes += int64(n)
+	if l.out.buf != nil && b.e.Level >= l.flushLevel {
+		if ferr := l.out.flush(); err == nil {
+			err = ferr
+		}
+	}
+	l.mu.Unlock()
+
+	putBuffer(b)
+	if err != nil && l.onError != nil {
+		l.onError(err)
+	}
+	return err
+}
+
+// process applies the message policies. A rewritten message is built in
+// b.out, which is not needed until the entry is encoded.
+func (l *Logger) process(b *buffer) {
+	if l.redact != nil {
+		if msg, ok := l.redact.redact(b.e.Message); ok {
+			b.out = append(b.out[:0], msg...)
+			b.swap()
+			if b.args > 0 {
+				l.redactArgs(b)
+			}
+		}
+	}
+	if l.sanitize {
+		msg := b.e.Message
+		body := strings.TrimSuffix(msg, "\n")
+		if needsSanitize(body, l.keepNewlines) {
+			b.out = appendSanitized(b.out[:0], body, l.keepNewlines)
+			b.out = append(b.out, msg[len(body):]...)
+			b.swap()
+		}
+	}
+	if len(b.e.Fields) > 0 && (l.redact != nil || l.sanitize || l.maxField > 0) {
+		l.processFields(b)
+	}
+	if l.maxEntry > 0 {
+		msg := b.e.Message
+		body := strings.TrimSuffix(msg, "\n")
+		if len(body) > l.maxEntry {
+			b.out = appendTruncated(b.out[:0], body, l.maxEntry)
+			b.out = append(b.out, msg[len(body):]...)
+			b.swap()
+			b.truncated = true
+		}
+	}
+}
+
+// processFields applies the message policies to the text values of the
+// fields, which are b's own copy.
+func (l *Logger) processFields(b *buffer) {
+	i := 0
+	if b.e.Template != "" {
+		i = 2 // the template and its hash are code, not data
+	}
+	for ; i < len(b.e.Fields); i++ {
+		if f, ok := l.processField(b, b.e.Fields[i]); ok {
+			b.e.Fields[i] = f
+		}
+	}
+}
+
+// processField returns f with its value masked, escaped or cut, and
+// whether that changed anything. Such values end up as strings.
+func (l *Logger) processField(b *buffer, f Field) (Field, bool) {
+	if l.redact != nil && l.redact.field(f.Key) {
+		return String(f.Key, l.redact.mask), true
+	}
+	if !f.isText() {
+		return f, false
+	}
+
+	s := f.str
+	if f.typ != stringType {
+		tmp := getBuffer()
+		tmp.msg = f.appendText(tmp.msg)
+		s = string(tmp.msg)
+		putBuffer(tmp)
+	}
+	changed := false
+	if l.redact != nil {
+		var ok bool
+		s, ok = l.redact.redact(s)
+		changed = changed || ok
+	}
+	if l.sanitize && needsSanitize(s, false) {
+		s = string(appendSanitized(nil, s, false))
+		changed = true
+	}
+	if l.maxField > 0 && len(s) > l.maxField {
+		s = string(appendTruncated(nil, s, l.maxField))
+		b.truncated = true
+		changed = true
+	}
+	// errors and other values that came through unchanged keep their type
+	if !changed {
+		return f, false
+	}
+	return String(f.Key, s), true
+}
+
+func (l *Logger) encoder(lv int) Encoder {
+	if enc, ok := l.levelEnc[lv]; ok {
+		return enc
+	}
+	if l.enc == nil {
+		return textEncoder{}
+	}
+	return l.enc
+}
+
+func (l *Logger) Level() int {
+	return int(atomic.LoadInt32(&l.level))
+}
+
+func (l *Logger) SetLevel(level int) {
+	atomic.StoreInt32(&l.level, int32(level))
+}
+
+// Printf calls l.Output to print to the logger.
+// Arguments are handled in the manner of fmt.Printf.
+func (l *Logger) Debug(format string, v ...interface{}) {
+	if DebugLevel >= l.Level() {
+		l.outputf(DebugLevel, 2, format, v)
+	}
+}
+
+func (l *Logger) Info(format string, v ...interface{}) {
+	if InfoLevel >= l.Level() {
+		l.outputf(InfoLevel, 2, format, v)
+	}
+}
+
+func (l *Logger) Warn(format string, v ...interface{}) {
+	if WarnLevel >= l.Level() {
+		l.outputf(WarnLevel, 2, format, v)
+	}
+}
+
+func (l *Logger) Error(format string, v ...interface{}) {
+	if ErrorLevel >= l.Level() {
+		l.outputf(ErrorLevel, 2, format, v)
+	}
+}
+
+// Fatal is equivalent to l.Print() followed by a call to os.Exit(1).
+func (l *Logger) Fatal(format string, v ...interface{}) {
+	if FatalLevel >= l.Level() {
+		l.outputf(FatalLevel, 2, format, v)
+	}
+	l.Flush()
+	os.Exit(1)
+}
+
+// Logw logs msg with fields at level lv. It is what the package level
+// Debugw ... Panicw call, the caller is reported as theirs.
+func (l *Logger) Logw(lv int, msg string, fields []Field) {
+	if lv >= l.Level() {
+		l.Outputw(lv, 3, msg, fields)
+	}
+}
+
+// Panicf is equivalent to l.Printf() followed by a call to panic().
+// The panic value is the formatted message, redacted as it is logged.
+func (l *Logger) Panic(format string, v ...interface{}) {
+	b := getBuffer()
+	logged := PanicLevel >= l.Level()
+	if logged {
+		l.begin(b, PanicLevel, 2)
+	}
+	l.formatf(b, format, v)
+	s := string(b.msg)
+	if l.redact != nil {
+		if msg, ok := l.redact.redact(s); ok {
+			s = msg
+		}
+	}
+	if logged {
+		l.emit(b)
+	} else {
+		putBuffer(b)
+	}
+	l.Flush()
+	panic(s)
+}
+
+// Flags returns the output flags for the logger.
+func (l *Logger) Flags() int {
+	return int(atomic.LoadInt32(&l.flag))
+}
+
+// SetFlags sets the output flags for the logger.
+func (l *Logger) SetFlags(flag int) {
+	atomic.StoreInt32(&l.flag, int32(flag))
+	for _, s := range l.sinks {
+		s.SetFlags(flag)
+	}
+}
+
+// GetPrefix returns the output prefix. The map must not be modified.
+func (l *Logger) GetPrefix() map[int]string {
+	return l.prefixes()
+}
+
+// Prefix returns the output prefix for the logger.
+func (l *Logger) Prefix(lv int) string {
+	return l.prefixes()[lv]
+}
+
+// SetPrefix sets the output prefix for the logger.
+func (l *Logger) SetPrefix(lv int, prefix string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	old := l.prefixes()
+	m := make(map[int]string, len(old)+1)
+	for k, v := range old {
+		m[k] = v
+	}
+	m[lv] = prefix
+	l.prefix.Store(m)
+	for _, s := range l.sinks {
+		s.SetPrefix(lv, prefix)
+	}
+}
+
+// Stats returns the counters of the logger.
+func (l *Logger) Stats() Stats {
+	if l.sinks != nil {
+		var st Stats
+		for _, s := range l.sinks {
+			ss := s.base().Stats()
+			st.Items += ss.Items
+			st.Bytes += ss.Bytes
+			st.Truncated += ss.Truncated
+			st.Dropped += ss.Dropped
+		}
+		return st
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return Stats{
+		Items:     l.items,
+		Bytes:     l.nbytes,
+		Truncated: l.truncated,
+		Dropped:   atomic.LoadInt64(&l.dropped),
+	}
+}
+
+// prefixes is read without the lock on every entry, so SetPrefix
+// replaces the map instead of modifying it.
+func (l *Logger) prefixes() map[int]string {
+	m, _ := l.prefix.Load().(map[int]string)
+	return m
+}
+
+func (o *outputer) Write(lv int, buf []byte) (int, error) {
+	if !o.cascade {
+		wr, ok := o.out[lv]
+		if !ok {
+			return 0, fmt.Errorf("No writer for level %d", lv)
+		}
+		return o.writeTo(wr, buf)
+	}
+
+	var (
+		written [LevelCount]io.WriteCloser
+		n, nw   int
+		err     error
+	)
+	for i := lv; i >= DebugLevel; i-- {
+		wr, ok := o.out[i]
+		if !ok || containsWriter(written[:nw], wr) {
+			continue
+		}
+		m, e := o.writeTo(wr, buf)
+		n += m
+		if e != nil && err == nil {
+			err = e
+		}
+		written[nw] = wr
+		nw++
+	}
+	if nw == 0 {
+		return 0, fmt.Errorf("No writer for level %d", lv)
+	}
+	return n, err
+}
+
+// writeTo writes buf to wr, or adds it to the buffer of wr in buffered
+// mode.
+func (o *outputer) writeTo(wr io.WriteCloser, buf []byte) (int, error) {
+	if o.buf == nil {
+		return wr.Write(buf)
+	}
+	pending := append(o.buf[wr], buf...)
+	o.buf[wr] = pending
+	if len(pending) < o.limit {
+		return len(buf), nil
+	}
+	o.buf[wr] = pending[:0]
+	if _, err := wr.Write(pending); err != nil {
+		return 0, err
+	}
+	return len(buf), nil
+}
+
+// flush writes the buffered output, then flushes the writers that hold
+// output of their own, such as a netWriter. The first error is returned,
+// after all writers had their turn.
+func (o *outputer) flush() error {
+	var first error
+	for wr, pending := range o.buf {
+		if len(pending) == 0 {
+			continue
+		}
+		o.buf[wr] = pending[:0]
+		if _, err := wr.Write(pending); err != nil && first == nil {
+			first = err
+		}
+	}
+	for _, wr := range distinctWriters(o.out) {
+		if f, ok := wr.(flusher); ok {
+			if err := f.Flush(); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+// flusher is a writer that holds output back, see outputer.flush.
+type flusher interface {
+	Flush() error
+}
+
+func containsWriter(ws []io.WriteCloser, w io.WriteCloser) bool {
+	for _, x := range ws {
+		if x == w {
+			return true
+		}
+	}
+	return false
+}
+
+// distinctWriters returns the writers of m, each once.
+func distinctWriters(m map[int]io.WriteCloser) []io.WriteCloser {
+	var ws []io.WriteCloser
+	for i := DebugLevel; i < LevelCount; i++ {
+		if w, ok := m[i]; ok && !containsWriter(ws, w) {
+			ws = append(ws, w)
+		}
+	}
+	return ws
+}
+
+func (l *Logger) Close() {
+	for _, s := range l.sinks {
+		s.Close()
+	}
+	l.shutdown()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.out.flush()
+	for _, w := range distinctWriters(l.out.out) {
+		w.Close()
+	}
+}
+
+// Flush writes what is buffered or queued, and waits for the writers that
+// hold entries back, such as those of the network sinks.
+func (l *Logger) Flush() {
+	for _, s := range l.sinks {
+		s.Flush()
+	}
+	if l.async != nil {
+		l.async.drain()
+	}
+	l.flush()
+}
+
+func (l *Logger) flush() {
+	l.mu.Lock()
+	err := l.out.flush()
+	l.mu.Unlock()
+	if err != nil && l.onError != nil {
+		l.onError(err)
+	}
+}
+
+func (l *Logger) flushRoutine(stop chan struct{}) {
+	tk := time.NewTicker(l.flushInterval)
+	defer tk.Stop()
+	for {
+		select {
+		case <-tk.C:
+			l.flush()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// shutdown ends the goroutines of the async and buffered modes, after
+// the queued entries are written.
+func (l *Logger) shutdown() {
+	if l.async != nil {
+		l.async.close()
+	}
+	l.stopFlush()
+}
+
+// stopFlush ends the flushRoutine of a buffered Logger.
+func (l *Logger) stopFlush() {
+	l.mu.Lock()
+	stop := l.stop
+	l.stop = nil
+	l.mu.Unlock()
+	if stop != nil {
+		close(stop)
+	}
+}
@@ -1,126 +1,508 @@
-package glog
-
-import (
-	"testing"
-	"time"
-)
-
-func TestLocal(t *testing.T) {
-	tm := time.Now()
-	t.Log(tm.Zone())
-}
-
-func TestLevel(t *testing.T) {
-	InitLogger(DEV, nil)
-	SetLevel(WarnLevel)
-	if Level() != WarnLevel {
-		t.Fail()
-		t.Log(_logger.Level())
-		c := _logger.(*console)
-		t.Log(c.level)
-	}
-}
-
-func testConsoleLog(t *testing.T) {
-	InitLogger(DEV, nil)
-	Debug("this is a debug info\n")
-	Info("this is a info %s", "logger init successfully.\n")
-	Warn("this is a warning: base value should not be %d\n", 0)
-	Error("this is a error log\n")
-
-	SetPrefix(InfoLevel, "information:")
-	Info("modify info log prefix to %s\n", Prefix(InfoLevel))
-	Info("no new line")
-	Info("new prefix info log\n")
-}
-
-func testFileLog(t *testing.T) {
-	InitLogger(PRO, map[string]interface{}{"typ": "file", "dir": "./logs"})
-	//InitLogger(PRO, map[string]interface{}{"typ": "file", "seconds": 15})
-	Debug("this is a debug info\n")
-	Info("this is a info %s", "logger init successfully.\n")
-	Warn("this is a warning: base value should not be %d\n", 0)
-	Error("this is a error log\n")
-
-	SetPrefix(InfoLevel, "information:")
-	Info("modify info log prefix to %s\n", Prefix(InfoLevel))
-	Info("no new line")
-	Info("new prefix info log\n")
-
-	time.Sleep(3 * time.Second)
-	Info("log after 3 seconds.")
-
-	time.Sleep(5 * time.Second)
-	Info("log after 5 seconds.")
-
-	time.Sleep(8 * time.Second)
-	Info("log after 8 seconds.")
-
-	time.Sleep(6 * time.Second)
-	Info("log after 6 seconds.")
-
-	time.Sleep(6 * time.Second)
-	Info("log after 6 seconds.")
-
-	Close()
-}
-
-func testFileLogClean(t *testing.T) {
-	InitLogger(PRO, map[string]interface{}{"typ": "file", "dir": "./logs", "suffix": "-{{yyyy}}{{mm}}{{dd}}"})
-	//InitLogger(PRO, map[string]interface{}{"typ": "file", "seconds": 5})
-	Debug("this is a debug info\n")
-	Info("this is a info %s", "logger init successfully.\n")
-	Warn("this is a warning: base value should not be %d\n", 0)
-	Error("this is a error log\n")
-
-	SetPrefix(InfoLevel, "information:")
-	Info("modify info log prefix to %s\n", Prefix(InfoLevel))
-	Info("no new line")
-	Info("new prefix info log\n")
-
-	time.Sleep(3 * time.Second)
-	Info("log after 3 seconds.")
-
-	time.Sleep(5 * time.Second)
-	Info("log after 5 seconds.")
-
-	time.Sleep(8 * time.Second)
-	Info("log after 8 seconds.")
-
-	time.Sleep(6 * time.Second)
-	Info("log after 6 seconds.")
-
-	time.Sleep(60 * time.Second)
-	Info("log after 6 seconds.")
-	Close()
-}
-
-/*
-func TestNsqLog(t *testing.T) {
-	InitLogger(PRO, map[string]interface{}{"typ": "nsq", "nsqdAddr": "10.10.133.80:4150"})
-
-	Debug("this is a debug info\n")
-	Info("this is a info %s", "logger init successfully.\n")
-	Warn("this is a warning: base value should not be %d\n", 0)
-	Error("this is a error log\n")
-
-	SetPrefix(InfoLevel, "information:")
-	Info("modify info log prefix to %s\n", Prefix(InfoLevel))
-	Info("no new line")
-	Info("new prefix info log\n")
-
-	time.Sleep(3 * time.Second)
-	Info("log after 3 seconds.")
-
-	time.Sleep(5 * time.Second)
-	Info("log after 5 seconds.")
-
-	time.Sleep(8 * time.Second)
-	Info("log after 8 seconds.")
-
-	time.Sleep(6 * time.Second)
-	Info("log after 6 seconds.")
-
-	Close()
-}
-*/
+package glog
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// newTestLogger returns a Logger writing every level to w.
+func newTestLogger(w io.Writer, flag int) *Logger {
+	l := &Logger{flag: int32(flag)}
+	l.out.out = make(map[int]io.WriteCloser)
+	for i := DebugLevel; i < LevelCount; i++ {
+		l.out.out[i] = nopCloser{w}
+	}
+	l.prefix.Store(map[int]string{
+		DebugLevel: "DEBUG",
+		InfoLevel:  "INFO",
+		WarnLevel:  "WARN",
+		ErrorLevel: "ERROR",
+		FatalLevel: "FATAL",
+		PanicLevel: "PANIC",
+	})
+	return l
+}
+
+func TestLocal(t *testing.T) {
+	tm := time.Now()
+	t.Log(tm.Zone())
+}
+
+func TestLevel(t *testing.T) {
+	InitLogger(DEV, nil)
+	SetLevel(WarnLevel)
+	if Level() != WarnLevel {
+		t.Fail()
+		t.Log(_logger.Level())
+		c := _logger.(*console)
+		t.Log(c.level)
+	}
+}
+
+func TestLoggerOutput(t *testing.T) {
+	var buf bytes.Buffer
+	l := newTestLogger(&buf, 0)
+	l.SetLevel(InfoLevel)
+
+	l.Debug("not written")
+	l.Info("hello %s", "world")
+	l.Warn("with newline\n")
+	l.SetPrefix(ErrorLevel, "E")
+	l.Error("%d", 42)
+
+	want := "INFO hello world\nWARN with newline\nE 42\n"
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+	if l.items != 3 || l.nbytes != int64(len(want)) {
+		t.Errorf("items=%d nbytes=%d", l.items, l.nbytes)
+	}
+
+	buf.Reset()
+	l.SetFlags(Lshortfile)
+	l.Info("caller")
+	if !bytes.HasPrefix(buf.Bytes(), []byte("log_test.go:")) {
+		t.Errorf("caller not reported: %q", buf.String())
+	}
+}
+
+func TestMultiline(t *testing.T) {
+	msg := "query failed:\nSELECT *\n  FROM t\n"
+	tests := []struct {
+		multiline string
+		want      string
+	}{
+		{"raw", "WARN query failed:\nSELECT *\n  FROM t\n"},
+		{"prefix", "WARN query failed:\nWARN SELECT *\nWARN   FROM t\n"},
+		{"indent", "WARN query failed:\n\tSELECT *\n\t  FROM t\n"},
+		{"escape", "WARN query failed:\\nSELECT *\\n  FROM t\n"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		l := newTestLogger(&buf, 0)
+		l.setOptions(map[string]interface{}{"multiline": tt.multiline})
+		l.Warn(msg)
+		if buf.String() != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.multiline, buf.String(), tt.want)
+		}
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		multiline string
+		msg       string
+		want      string
+	}{
+		{"raw", "plain\n", "INFO plain\n"},
+		{"raw", "user x\nINFO admin logged in\n", "INFO user x\\nINFO admin logged in\n"},
+		{"raw", "\x1b[31mred\x1b[0m\r", "INFO \\x1b[31mred\\x1b[0m\\r\n"},
+		{"raw", "bad \xff utf8, \u009b csi, \u202e bidi", "INFO bad \ufffd utf8, \\u009b csi, \\u202e bidi\n"},
+		{"indent", "a\nb\x00\n", "INFO a\n\tb\\x00\n"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		l := newTestLogger(&buf, 0)
+		l.setOptions(map[string]interface{}{"sanitize": true, "multiline": tt.multiline})
+		l.Info("%s", tt.msg)
+		if buf.String() != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.msg, buf.String(), tt.want)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	var buf bytes.Buffer
+	l := newTestLogger(&buf, 0)
+	l.setOptions(map[string]interface{}{"maxFieldBytes": 8})
+	l.Info("short %s\n", "arg")
+	l.Info("field %s|%5.2f|%x", "0123456789", 3.14159, []byte("abcdefgh"))
+	l.Info("%d %T", int64(1234567890123), "long string")
+
+	want := "INFO short arg\n" +
+		"INFO field 01234567…[truncated 2 bytes]| 3.14|61626364…[truncated 8 bytes]\n" +
+		"INFO 1234567890123 string\n"
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+	if st := l.Stats(); st.Items != 3 || st.Truncated != 1 || st.Bytes != int64(buf.Len()) {
+		t.Errorf("stats %+v", st)
+	}
+
+	buf.Reset()
+	l = newTestLogger(&buf, 0)
+	l.setOptions(map[string]interface{}{"maxEntryBytes": 16})
+	l.Info("entry 0123456789 0123456789\n")
+	l.Info("héllo wörld héllo wörld")
+
+	want = "INFO entry 0123456789…[truncated 11 bytes]\n" +
+		"INFO héllo wörld h…[truncated 12 bytes]\n"
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+	if st := l.Stats(); st.Truncated != 2 {
+		t.Errorf("stats %+v", st)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	var buf bytes.Buffer
+	l := newTestLogger(&buf, 0)
+	l.setOptions(map[string]interface{}{
+		"redactFields":   []string{"password", "Token"},
+		"redactPatterns": []string{RedactEmail, RedactCreditCard, RedactBearer},
+		"maxFieldBytes":  24,
+	})
+
+	l.Info("login user=bob password=hunter2 access_token: 'abc def' ok")
+	l.Info(`{"password": "x y", "card": "4111 1111 1111 1111"}`)
+	l.Info("mail %s from %s", "bob@example.com", "Authorization: Bearer eyJhbGciOi.J9")
+	l.Info("%s", "0123456789 alice@example.org 0123456789")
+	l.Info("nothing to hide")
+
+	want := "INFO login user=bob password=[REDACTED] access_token: [REDACTED] ok\n" +
+		`INFO {"password": [REDACTED], "card": "[REDACTED]"}` + "\n" +
+		"INFO mail [REDACTED] from Authorization: [REDACTED…[truncated 1 bytes]\n" +
+		"INFO 0123456789 [REDACTED] 01…[truncated 8 bytes]\n" +
+		"INFO nothing to hide\n"
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func BenchmarkRedactNoMatch(b *testing.B) {
+	l := newTestLogger(io.Discard, LstdFlags)
+	l.setOptions(map[string]interface{}{
+		"redactFields":   []string{"password", "token", "authorization"},
+		"redactPatterns": []string{RedactEmail, RedactCreditCard, RedactBearer},
+	})
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.Info("request %s served in %d ms", "/api/v1/items", 42)
+	}
+}
+
+func TestDisabledLevelNoAllocs(t *testing.T) {
+	l := newTestLogger(io.Discard, LstdFlags)
+	l.SetLevel(InfoLevel)
+	n := testing.AllocsPerRun(100, func() {
+		l.Debug("value %d of %s", 42, "disabled")
+	})
+	if n != 0 {
+		t.Errorf("disabled level allocates %v times per entry", n)
+	}
+}
+
+func BenchmarkDisabledLevel(b *testing.B) {
+	l := newTestLogger(io.Discard, LstdFlags)
+	l.SetLevel(InfoLevel)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.Debug("value %d of %s", 42, "disabled")
+	}
+}
+
+func BenchmarkInfo(b *testing.B) {
+	l := newTestLogger(io.Discard, LstdFlags)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.Info("value %d of %s", 42, "enabled")
+	}
+}
+
+func BenchmarkInfoShortfile(b *testing.B) {
+	l := newTestLogger(io.Discard, LstdFlags|Lshortfile)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		l.Info("value %d of %s", 42, "enabled")
+	}
+}
+
+func BenchmarkInfoParallel(b *testing.B) {
+	l := newTestLogger(io.Discard, LstdFlags)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			l.Info("value %d of %s", 42, "enabled")
+		}
+	})
+}
+
+func testConsoleLog(t *testing.T) {
+	InitLogger(DEV, nil)
+	Debug("this is a debug info\n")
+	Info("this is a info %s", "logger init successfully.\n")
+	Warn("this is a warning: base value should not be %d\n", 0)
+	Error("this is a error log\n")
+
+	SetPrefix(InfoLevel, "information:")
+	Info("modify info log prefix to %s\n", Prefix(InfoLevel))
+	Info("no new line")
+	Info("new prefix info log\n")
+}
+
+func testFileLog(t *testing.T) {
+	InitLogger(PRO, map[string]interface{}{"typ": "file", "dir": "./logs"})
+	//InitLogger(PRO, map[string]interface{}{"typ": "file", "seconds": 15})
+	Debug("this is a debug info\n")
+	Info("this is a info %s", "logger init successfully.\n")
+	Warn("this is a warning: base value should not be %d\n", 0)
+	Error("this is a error log\n")
+
+	SetPrefix(InfoLevel, "information:")
+	Info("modify info log prefix to %s\n", Prefix(InfoLevel))
+	Info("no new line")
+	Info("new prefix info log\n")
+
+	time.Sleep(3 * time.Second)
+	Info("log after 3 seconds.")
+
+	time.Sleep(5 * time.Second)
+	Info("log after 5 seconds.")
+
+	time.Sleep(8 * time.Second)
+	Info("log after 8 seconds.")
+
+	time.Sleep(6 * time.Second)
+	Info("log after 6 seconds.")
+
+	time.Sleep(6 * time.Second)
+	Info("log after 6 seconds.")
+
+	Close()
+}
+
+func testFileLogClean(t *testing.T) {
+	InitLogger(PRO, map[string]interface{}{"typ": "file", "dir": "./logs", "suffix": "-{{yyyy}}{{mm}}{{dd}}"})
+	//InitLogger(PRO, map[string]interface{}{"typ": "file", "seconds": 5})
+	Debug("this is a debug info\n")
+	Info("this is a info %s", "logger init successfully.\n")
+	Warn("this is a warning: base value should not be %d\n", 0)
+	Error("this is a error log\n")
+
+	SetPrefix(InfoLevel, "information:")
+	Info("modify info log prefix to %s\n", Prefix(InfoLevel))
+	Info("no new line")
+	Info("new prefix info log\n")
+
+	time.Sleep(3 * time.Second)
+	Info("log after 3 seconds.")
+
+	time.Sleep(5 * time.Second)
+	Info("log after 5 seconds.")
+
+	time.Sleep(8 * time.Second)
+	Info("log after 8 seconds.")
+
+	time.Sleep(6 * time.Second)
+	Info("log after 6 seconds.")
+
+	time.Sleep(60 * time.Second)
+	Info("log after 6 seconds.")
+	Close()
+}
+
+/*
+func TestNsqLog(t *testing.T) {
+	InitLogger(PRO, map[string]interface{}{"typ": "nsq", "nsqdAddr": "10.10.133.80:4150"})
+
+	Debug("this is a debug info\n")
+	Info("this is a info %s", "logger init successfully.\n")
+	Warn("this is a warning: base value should not be %d\n", 0)
+	Error("this is a error log\n")
+
+	SetPrefix(InfoLevel, "information:")
+	Info("modify info log prefix to %s\n", Prefix(InfoLevel))
+	Info("no new line")
+	Info("new prefix info log\n")
+
+	time.Sleep(3 * time.Second)
+	Info("log after 3 seconds.")
+
+	time.Sleep(5 * time.Second)
+	Info("log after 5 seconds.")
+
+	time.Sleep(8 * time.Second)
+	Info("log after 8 seconds.")
+
+	time.Sleep(6 * time.Second)
+	Info("log after 6 seconds.")
+
+	Close()
+}
+*/
+
+func TestSequence(t *testing.T) {
+	var w bytes.Buffer
+	l := newTestLogger(&w, Linstance|Lsequence)
+	l.Info("a")
+	l.Error("b")
+	lines := strings.Split(strings.TrimSuffix(w.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %q", w.String())
+	}
+	var n [2]uint64
+	for i, line := range lines {
+		var id string
+		if _, err := fmt.Sscanf(line, "%s #%d", &id, &n[i]); err != nil || id != InstanceID() {
+			t.Errorf("line %q: id %q, %v", line, id, err)
+		}
+	}
+	if n[1] != n[0]+1 {
+		t.Errorf("sequence numbers %d, %d are not consecutive", n[0], n[1])
+	}
+
+	w.Reset()
+	l.setOptions(map[string]interface{}{"encoding": "json"})
+	l.SetFlags(Lsequence)
+	l.Info("c")
+	if want := fmt.Sprintf(`,"level":"INFO","seq":%d,"msg":"c"}`, n[1]+1); !strings.Contains(w.String(), want) {
+		t.Errorf("json: got %s, want %s", w.String(), want)
+	}
+	if len(InstanceID()) != 16 {
+		t.Errorf("instance ID %q", InstanceID())
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	var w bytes.Buffer
+	l := newTestLogger(&w, 0)
+	l.setOptions(map[string]interface{}{
+		"encoding":     "logfmt",
+		"templates":    true,
+		"redactFields": []string{"password"},
+	})
+	l.Info("user %s logged in from %s", "bob", "10.0.0.1")
+	l.Info("user %s has password=%s", "bob", "hunter2")
+	hash := TemplateHash("user %s logged in from %s")
+	want := `msg="user bob logged in from 10.0.0.1" template="user %s logged in from %s" template_hash=` + hash +
+		` arg0=bob arg1=10.0.0.1` + "\n" +
+		`msg="user bob has password=[REDACTED]" template="user %s has password=%s" template_hash=` +
+		TemplateHash("user %s has password=%s") + ` arg0=bob arg1=[REDACTED]` + "\n"
+	got := regexp.MustCompile(`(?m)^time=.* level=INFO `).ReplaceAllString(w.String(), "")
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	if TemplateHash("a %d") == TemplateHash("a %s") {
+		t.Error("different templates have the same hash")
+	}
+}
+
+func TestTee(t *testing.T) {
+	var console, json bytes.Buffer
+	var errs []error
+	l := createTeeLogger(map[string]interface{}{
+		"flag":         0,
+		"redactFields": []string{"password"},
+		"sinks": []map[string]interface{}{
+			{"typ": "console", "output": &console, "color": true, "level": InfoLevel},
+			{"typ": "console", "output": &json, "encoding": "json", "level": WarnLevel},
+			{"typ": "console", "output": failWriter{}, "onError": func(err error) { errs = append(errs, err) }},
+			{"typ": "carrier pigeon"},
+		},
+	})
+	if len(l.sinks) != 3 || l.Level() != DebugLevel {
+		t.Fatalf("%d sinks, level %d", len(l.sinks), l.Level())
+	}
+	l.Debug("debug")
+	l.Warn("password=%s", "secret")
+	l.Logw(ErrorLevel, "err", []Field{Int("n", 1)})
+
+	if want := "\x1b[33mWARN\x1b[0m password=[REDACTED]\n\x1b[31mERROR\x1b[0m err n=1\n"; console.String() != want {
+		t.Errorf("console: got %q, want %q", console.String(), want)
+	}
+	got := regexp.MustCompile(`"time":"[^"]*",`).ReplaceAllString(json.String(), "")
+	if want := `{"level":"WARN","msg":"password=[REDACTED]"}` + "\n" + `{"level":"ERROR","msg":"err","n":1}` + "\n"; got != want {
+		t.Errorf("json: got %s, want %s", got, want)
+	}
+	if len(errs) != 3 {
+		t.Errorf("got %d errors, want 3", len(errs))
+	}
+	if st := l.Stats(); st.Items != 7 {
+		t.Errorf("stats %+v, want 7 items", st)
+	}
+
+	l.SetFlags(Lsequence)
+	if l.sinks[1].Flags() != Lsequence {
+		t.Errorf("SetFlags did not reach the sinks")
+	}
+	l.Close()
+}
+
+type failWriter struct{}
+
+func (failWriter) Write(p []byte) (int, error) { return 0, io.ErrShortWrite }
+
+// countWriter counts the calls to Write.
+type countWriter struct {
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	writes int
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.writes++
+	return w.buf.Write(p)
+}
+
+func (w *countWriter) get() (string, int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.String(), w.writes
+}
+
+func TestBuffered(t *testing.T) {
+	var w countWriter
+	l := newTestLogger(&w, 0)
+	l.setOptions(map[string]interface{}{"buffered": true, "bufferSize": 32, "flushInterval": time.Hour})
+	defer l.Close()
+
+	l.Info("a")
+	l.Warn("b")
+	if s, n := w.get(); n != 0 {
+		t.Fatalf("written before a flush: %q", s)
+	}
+	l.Flush()
+	if s, n := w.get(); s != "INFO a\nWARN b\n" || n != 1 {
+		t.Errorf("after Flush: %q in %d writes", s, n)
+	}
+
+	l.Info("0123456789")
+	l.Info("0123456789")
+	l.Info("0123456789") // beyond bufferSize
+	if _, n := w.get(); n != 2 {
+		t.Errorf("got %d writes, want 2 after filling the buffer", n)
+	}
+	l.Error("c")
+	if s, n := w.get(); !strings.HasSuffix(s, "ERROR c\n") || n != 3 {
+		t.Errorf("flushLevel: %q in %d writes", s, n)
+	}
+
+	l2 := newTestLogger(&w, 0)
+	l2.setOptions(map[string]interface{}{"buffered": true, "flushInterval": time.Millisecond})
+	l2.Info("d")
+	for i := 0; i < 1000; i++ {
+		if s, _ := w.get(); strings.HasSuffix(s, "INFO d\n") {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if s, _ := w.get(); !strings.HasSuffix(s, "INFO d\n") {
+		t.Errorf("not flushed by the interval: %q", s)
+	}
+	l2.Close()
+}
@@ -0,0 +1,490 @@
+package glog
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ObjectMarshaler is implemented by types that log themselves as a set of
+// fields, see Object. Other structs passed to Any, or to %v in a printf
+// style call, are logged by reflection, with their exported fields
+// controlled by log tags:
+//
+//	Password string `log:"-"`           // left out
+//	Token    string `log:"token,redact"` // renamed, value masked
+//	Secret   string `log:",redact"`      // value masked
+type ObjectMarshaler interface {
+	MarshalLogObject(enc ObjectEncoder) error
+}
+
+// ArrayMarshaler is implemented by types that log themselves as a list of
+// values, see Array.
+type ArrayMarshaler interface {
+	MarshalLogArray(enc ArrayEncoder) error
+}
+
+// ObjectEncoder receives the fields of an ObjectMarshaler. The JSON
+// encoder writes them as a nested object, the text and logfmt encoders
+// as fields with dotted keys.
+type ObjectEncoder interface {
+	AddString(key string, val string)
+	AddInt64(key string, val int64)
+	AddFloat64(key string, val float64)
+	AddBool(key string, val bool)
+	AddDuration(key string, val time.Duration)
+	AddTime(key string, val time.Time)
+	AddObject(key string, val ObjectMarshaler)
+	AddArray(key string, val ArrayMarshaler)
+	AddAny(key string, val interface{})
+}
+
+// ArrayEncoder receives the values of an ArrayMarshaler.
+type ArrayEncoder interface {
+	AppendString(val string)
+	AppendInt64(val int64)
+	AppendFloat64(val float64)
+	AppendBool(val bool)
+	AppendDuration(val time.Duration)
+	AppendTime(val time.Time)
+	AppendObject(val ObjectMarshaler)
+	AppendArray(val ArrayMarshaler)
+	AppendAny(val interface{})
+}
+
+// Object constructs a field from an ObjectMarshaler.
+func Object(key string, val ObjectMarshaler) Field {
+	return Field{Key: key, typ: objectType, iface: val}
+}
+
+// Array constructs a field from an ArrayMarshaler.
+func Array(key string, val ArrayMarshaler) Field {
+	return Field{Key: key, typ: arrayType, iface: val}
+}
+
+// fieldAdder is implemented by all the object and array encoders of this
+// package, so values built by reflection go in without boxing them again.
+type fieldAdder interface {
+	add(f Field)
+}
+
+// The Add and Append methods of the encoders all go through add.
+type addMethods struct {
+	fieldAdder
+}
+
+func (a addMethods) AddString(key string, val string)          { a.add(String(key, val)) }
+func (a addMethods) AddInt64(key string, val int64)            { a.add(Int64(key, val)) }
+func (a addMethods) AddFloat64(key string, val float64)        { a.add(Float64(key, val)) }
+func (a addMethods) AddBool(key string, val bool)              { a.add(Bool(key, val)) }
+func (a addMethods) AddDuration(key string, val time.Duration) { a.add(Duration(key, val)) }
+func (a addMethods) AddTime(key string, val time.Time)         { a.add(Time(key, val)) }
+func (a addMethods) AddObject(key string, val ObjectMarshaler) { a.add(Object(key, val)) }
+func (a addMethods) AddArray(key string, val ArrayMarshaler)   { a.add(Array(key, val)) }
+func (a addMethods) AddAny(key string, val interface{})        { a.add(Any(key, val)) }
+
+func (a addMethods) AppendString(val string)          { a.add(String("", val)) }
+func (a addMethods) AppendInt64(val int64)            { a.add(Int64("", val)) }
+func (a addMethods) AppendFloat64(val float64)        { a.add(Float64("", val)) }
+func (a addMethods) AppendBool(val bool)              { a.add(Bool("", val)) }
+func (a addMethods) AppendDuration(val time.Duration) { a.add(Duration("", val)) }
+func (a addMethods) AppendTime(val time.Time)         { a.add(Time("", val)) }
+func (a addMethods) AppendObject(val ObjectMarshaler) { a.add(Object("", val)) }
+func (a addMethods) AppendArray(val ArrayMarshaler)   { a.add(Array("", val)) }
+func (a addMethods) AppendAny(val interface{})        { a.add(Any("", val)) }
+
+// jsonObject writes fields as the members of a JSON object, or as the
+// elements of an array. Inside objects and arrays the redaction rules are
+// applied here, the fields of the entry itself went through the Logger.
+type jsonObject struct {
+	buf    []byte
+	n      int
+	redact *redactor
+	array  bool
+	nested bool
+}
+
+func (o *jsonObject) add(f Field) {
+	if o.n > 0 {
+		o.buf = append(o.buf, ',')
+	}
+	o.n++
+	if !o.array {
+		o.buf = appendJSONString(o.buf, f.Key)
+		o.buf = append(o.buf, ':')
+	}
+	if o.nested {
+		f = o.redact.nested(f)
+	}
+
+	var err error
+	switch f.typ {
+	case objectType:
+		sub := &jsonObject{buf: append(o.buf, '{'), redact: o.redact, nested: true}
+		err = f.iface.(ObjectMarshaler).MarshalLogObject(addMethods{sub})
+		o.buf = append(sub.buf, '}')
+	case arrayType:
+		sub := &jsonObject{buf: append(o.buf, '['), redact: o.redact, array: true, nested: true}
+		err = f.iface.(ArrayMarshaler).MarshalLogArray(addMethods{sub})
+		o.buf = append(sub.buf, ']')
+	default:
+		o.buf = f.appendJSON(o.buf)
+	}
+	if err != nil && !o.array {
+		o.add(String(f.Key+"Error", err.Error()))
+	}
+}
+
+// textObject writes fields as " key=value", the keys of nested objects
+// prefixed with the key of their parent and a dot. Arrays are written as
+// one value, "[a,b,{c=d}]".
+type textObject struct {
+	buf    []byte
+	prefix string
+	redact *redactor
+	array  bool
+	nested bool
+	n      int
+}
+
+func (o *textObject) add(f Field) {
+	key := f.Key
+	if o.prefix != "" {
+		key = o.prefix + "." + key
+	}
+	if o.nested {
+		f = o.redact.nested(f)
+	}
+
+	var err error
+	if f.typ == objectType && !o.array {
+		sub := &textObject{buf: o.buf, prefix: key, redact: o.redact, nested: true}
+		err = f.iface.(ObjectMarshaler).MarshalLogObject(addMethods{sub})
+		o.buf = sub.buf
+	} else {
+		if o.array {
+			if o.n > 0 {
+				o.buf = append(o.buf, ',')
+			}
+		} else {
+			o.buf = append(o.buf, ' ')
+			o.buf = append(o.buf, key...)
+			o.buf = append(o.buf, '=')
+		}
+		switch f.typ {
+		case objectType, arrayType:
+			tmp := getBuffer()
+			tmp.msg, err = appendTextValue(tmp.msg, f, o.redact)
+			if o.array {
+				o.buf = append(o.buf, tmp.msg...)
+			} else {
+				o.buf = String("", tmp.message()).appendQuotedText(o.buf)
+			}
+			putBuffer(tmp)
+		default:
+			o.buf = f.appendQuotedText(o.buf)
+		}
+	}
+	o.n++
+	if err != nil && !o.array {
+		o.add(String(f.Key+"Error", err.Error()))
+	}
+}
+
+// appendTextValue appends an object as "{a=b c=d}" and an array as
+// "[a,b]".
+func appendTextValue(dst []byte, f Field, r *redactor) ([]byte, error) {
+	var err error
+	switch f.typ {
+	case objectType:
+		sub := &textObject{buf: append(dst, '{'), redact: r, nested: true}
+		err = f.iface.(ObjectMarshaler).MarshalLogObject(addMethods{sub})
+		if sub.n > 0 {
+			// drop the space in front of the first key
+			copy(sub.buf[len(dst)+1:], sub.buf[len(dst)+2:])
+			sub.buf = sub.buf[:len(sub.buf)-1]
+		}
+		return append(sub.buf, '}'), err
+	case arrayType:
+		sub := &textObject{buf: append(dst, '['), redact: r, array: true, nested: true}
+		err = f.iface.(ArrayMarshaler).MarshalLogArray(addMethods{sub})
+		return append(sub.buf, ']'), err
+	}
+	return f.appendText(dst), nil
+}
+
+// redactedValue replaces the fields tagged with redact.
+const redactedValue = "[REDACTED]"
+
+// Limits for logging values by reflection.
+const (
+	maxReflectDepth    = 8
+	maxReflectElements = 100
+)
+
+var (
+	reflectTime     = reflect.TypeOf(time.Time{})
+	reflectDuration = reflect.TypeOf(time.Duration(0))
+	reflectError    = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// reflectField builds the field for a value with no constructor of its
+// own. Structs become objects following their log tags, slices and arrays
+// become arrays, maps with string keys objects.
+func reflectField(key string, v reflect.Value, depth int) Field {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return Field{Key: key, typ: anyType}
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return Field{Key: key, typ: anyType}
+	}
+	if v.CanInterface() {
+		switch val := v.Interface().(type) {
+		case ObjectMarshaler:
+			return Object(key, val)
+		case ArrayMarshaler:
+			return Array(key, val)
+		}
+	}
+	if depth >= maxReflectDepth {
+		return String(key, "…")
+	}
+
+	t := v.Type()
+	switch {
+	case t == reflectTime && v.CanInterface():
+		return Time(key, v.Interface().(time.Time))
+	case t == reflectDuration:
+		return Duration(key, time.Duration(v.Int()))
+	case t.Implements(reflectError) && v.CanInterface():
+		return Field{Key: key, typ: errorType, iface: v.Interface()}
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return String(key, v.String())
+	case reflect.Bool:
+		return Bool(key, v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return Int64(key, v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if u := v.Uint(); u <= 1<<63-1 {
+			return Int64(key, int64(u))
+		}
+		return String(key, strconv.FormatUint(v.Uint(), 10))
+	case reflect.Float32, reflect.Float64:
+		return Float64(key, v.Float())
+	case reflect.Struct:
+		return Object(key, structObject{v, depth + 1})
+	case reflect.Map:
+		if t.Key().Kind() == reflect.String {
+			return Object(key, mapObject{v, depth + 1})
+		}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return Field{Key: key, typ: anyType, iface: v.Interface()}
+		}
+		return Array(key, sliceArray{v, depth + 1})
+	}
+	if v.CanInterface() {
+		return Field{Key: key, typ: anyType, iface: v.Interface()}
+	}
+	return String(key, v.String())
+}
+
+// addReflected adds a value built by reflection to enc.
+func addReflected(enc interface{}, f Field) {
+	if a, ok := enc.(fieldAdder); ok {
+		a.add(f)
+		return
+	}
+	switch e := enc.(type) {
+	case ObjectEncoder:
+		e.AddAny(f.Key, f.iface)
+	case ArrayEncoder:
+		e.AppendAny(f.iface)
+	}
+}
+
+// structObject logs the exported fields of a struct following their log
+// tags, see ObjectMarshaler.
+type structObject struct {
+	v     reflect.Value
+	depth int
+}
+
+func (s structObject) MarshalLogObject(enc ObjectEncoder) error {
+	t := s.v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		name := sf.Name
+		redact := false
+		if tag, ok := sf.Tag.Lookup("log"); ok {
+			if tag == "-" {
+				continue
+			}
+			opts := strings.Split(tag, ",")
+			if opts[0] != "" {
+				name = opts[0]
+			}
+			for _, o := range opts[1:] {
+				if o == "redact" {
+					redact = true
+				}
+			}
+		}
+		if redact {
+			enc.AddString(name, redactedValue)
+			continue
+		}
+		addReflected(enc, reflectField(name, s.v.Field(i), s.depth))
+	}
+	return nil
+}
+
+// mapObject logs a map with string keys.
+type mapObject struct {
+	v     reflect.Value
+	depth int
+}
+
+func (m mapObject) MarshalLogObject(enc ObjectEncoder) error {
+	keys := m.v.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].String() < keys[j].String()
+	})
+	for _, k := range keys {
+		addReflected(enc, reflectField(k.String(), m.v.MapIndex(k), m.depth))
+	}
+	return nil
+}
+
+// sliceArray logs a slice or array, at most maxReflectElements of it.
+type sliceArray struct {
+	v     reflect.Value
+	depth int
+}
+
+func (s sliceArray) MarshalLogArray(enc ArrayEncoder) error {
+	n := s.v.Len()
+	for i := 0; i < n && i < maxReflectElements; i++ {
+		addReflected(enc, reflectField("", s.v.Index(i), s.depth))
+	}
+	if n > maxReflectElements {
+		enc.AppendString("…" + strconv.Itoa(n-maxReflectElements) + " more")
+	}
+	return nil
+}
+
+// marshalArgs replaces the struct arguments of a printf style call by
+// what Any makes of them, so that %v follows their log tags and the
+// reflection limits rather than dumping every field. Values that format
+// themselves, as a fmt.Formatter, fmt.Stringer or error, are left alone,
+// and so are the arguments of %T and %p, which fmt answers without asking.
+func (l *Logger) marshalArgs(format string, v []interface{}) []interface{} {
+	var mv []interface{}
+	var types []bool
+	for i, a := range v {
+		f, ok := argField(a)
+		if !ok {
+			continue
+		}
+		if mv == nil {
+			types = typeArgs(format, len(v))
+			mv = append([]interface{}(nil), v...)
+		}
+		if !types[i] {
+			mv[i] = marshaledArg{a, f, l.redact}
+		}
+	}
+	if mv == nil {
+		return v
+	}
+	return mv
+}
+
+// typeArgs reports which of the n arguments of format go to %T or %p.
+func typeArgs(format string, n int) []bool {
+	types := make([]bool, n)
+	arg := 0
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		for i++; i < len(format); i++ {
+			c := format[i]
+			if c == '[' {
+				k, j := 0, i+1
+				for ; j < len(format) && format[j] >= '0' && format[j] <= '9'; j++ {
+					k = k*10 + int(format[j]-'0')
+				}
+				if j < len(format) && format[j] == ']' && k > 0 {
+					arg, i = k-1, j
+				}
+				continue
+			}
+			if c == '*' {
+				arg++
+				continue
+			}
+			if c == '+' || c == '-' || c == '#' || c == ' ' || c == '.' || c >= '0' && c <= '9' {
+				continue
+			}
+			if c != '%' {
+				if (c == 'T' || c == 'p') && arg < n {
+					types[arg] = true
+				}
+				arg++
+			}
+			break
+		}
+	}
+	return types
+}
+
+// argField returns the field of a printf argument that is a struct, a
+// pointer to one, or a marshaler.
+func argField(a interface{}) (Field, bool) {
+	switch a.(type) {
+	case ObjectMarshaler, ArrayMarshaler:
+		return Any("", a), true
+	case fmt.Formatter, fmt.Stringer, error, nil:
+		return Field{}, false
+	}
+	t := reflect.TypeOf(a)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return Field{}, false
+	}
+	return reflectField("", reflect.ValueOf(a), 0), true
+}
+
+// marshaledArg formats an argument for %v and %s as its field reads in a
+// text line; other verbs get the value itself.
+type marshaledArg struct {
+	v      interface{}
+	f      Field
+	redact *redactor
+}
+
+func (a marshaledArg) Format(s fmt.State, verb rune) {
+	if verb != 'v' && verb != 's' {
+		fmt.Fprintf(s, fmt.FormatString(s, verb), a.v)
+		return
+	}
+	tmp := getBuffer()
+	tmp.msg, _ = appendTextValue(tmp.msg, a.f, a.redact)
+	s.Write(tmp.msg)
+	putBuffer(tmp)
+}
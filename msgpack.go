@@ -0,0 +1,345 @@
+package glog
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// The parts of MessagePack the fluentd sink needs: appending values, and
+// reading them back for acks and tests.
+
+func appendMsgpackNil(dst []byte) []byte {
+	return append(dst, 0xc0)
+}
+
+func appendMsgpackBool(dst []byte, v bool) []byte {
+	if v {
+		return append(dst, 0xc3)
+	}
+	return append(dst, 0xc2)
+}
+
+func appendMsgpackInt(dst []byte, v int64) []byte {
+	switch {
+	case v >= 0 && v <= 0x7f:
+		return append(dst, byte(v))
+	case v < 0 && v >= -32:
+		return append(dst, byte(v))
+	case v >= math.MinInt32 && v <= math.MaxInt32:
+		return binary.BigEndian.AppendUint32(append(dst, 0xd2), uint32(v))
+	}
+	return binary.BigEndian.AppendUint64(append(dst, 0xd3), uint64(v))
+}
+
+func appendMsgpackFloat(dst []byte, v float64) []byte {
+	return binary.BigEndian.AppendUint64(append(dst, 0xcb), math.Float64bits(v))
+}
+
+func appendMsgpackString(dst []byte, s string) []byte {
+	switch n := len(s); {
+	case n < 32:
+		dst = append(dst, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		dst = append(dst, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		dst = binary.BigEndian.AppendUint16(append(dst, 0xda), uint16(n))
+	default:
+		dst = binary.BigEndian.AppendUint32(append(dst, 0xdb), uint32(n))
+	}
+	return append(dst, s...)
+}
+
+// appendMsgpackBinHeader appends the header of a bin value of n bytes,
+// always as bin 32.
+func appendMsgpackBinHeader(dst []byte, n int) []byte {
+	return binary.BigEndian.AppendUint32(append(dst, 0xc6), uint32(n))
+}
+
+func appendMsgpackArrayHeader(dst []byte, n int) []byte {
+	if n < 16 {
+		return append(dst, 0x90|byte(n))
+	}
+	if n <= math.MaxUint16 {
+		return binary.BigEndian.AppendUint16(append(dst, 0xdc), uint16(n))
+	}
+	return binary.BigEndian.AppendUint32(append(dst, 0xdd), uint32(n))
+}
+
+func appendMsgpackMapHeader(dst []byte, n int) []byte {
+	if n < 16 {
+		return append(dst, 0x80|byte(n))
+	}
+	if n <= math.MaxUint16 {
+		return binary.BigEndian.AppendUint16(append(dst, 0xde), uint16(n))
+	}
+	return binary.BigEndian.AppendUint32(append(dst, 0xdf), uint32(n))
+}
+
+// appendMsgpackEventTime appends t as the EventTime extension of
+// Fluentd: type 0, seconds and nanoseconds as 32 bit big endian.
+func appendMsgpackEventTime(dst []byte, t time.Time) []byte {
+	dst = append(dst, 0xd7, 0x00)
+	dst = binary.BigEndian.AppendUint32(dst, uint32(t.Unix()))
+	return binary.BigEndian.AppendUint32(dst, uint32(t.Nanosecond()))
+}
+
+// msgpackObject writes fields as the entries of a map, or as the
+// elements of an array. The header is written as map 32 or array 32 and
+// the count filled in by end, once it is known.
+type msgpackObject struct {
+	buf    []byte
+	n      int
+	hdr    int // where the header is
+	redact *redactor
+	array  bool
+	nested bool
+}
+
+func (o *msgpackObject) begin() {
+	o.hdr = len(o.buf)
+	if o.array {
+		o.buf = append(o.buf, 0xdd, 0, 0, 0, 0)
+	} else {
+		o.buf = append(o.buf, 0xdf, 0, 0, 0, 0)
+	}
+}
+
+func (o *msgpackObject) end() []byte {
+	binary.BigEndian.PutUint32(o.buf[o.hdr+1:], uint32(o.n))
+	return o.buf
+}
+
+func (o *msgpackObject) add(f Field) {
+	o.n++
+	if !o.array {
+		o.buf = appendMsgpackString(o.buf, f.Key)
+	}
+	if o.nested {
+		f = o.redact.nested(f)
+	}
+
+	var err error
+	switch f.typ {
+	case int64Type:
+		o.buf = appendMsgpackInt(o.buf, f.num)
+	case float64Type:
+		o.buf = appendMsgpackFloat(o.buf, math.Float64frombits(uint64(f.num)))
+	case boolType:
+		o.buf = appendMsgpackBool(o.buf, f.num != 0)
+	case objectType:
+		sub := &msgpackObject{buf: o.buf, redact: o.redact, nested: true}
+		sub.begin()
+		err = f.iface.(ObjectMarshaler).MarshalLogObject(addMethods{sub})
+		o.buf = sub.end()
+	case arrayType:
+		sub := &msgpackObject{buf: o.buf, redact: o.redact, array: true, nested: true}
+		sub.begin()
+		err = f.iface.(ArrayMarshaler).MarshalLogArray(addMethods{sub})
+		o.buf = sub.end()
+	default:
+		if f.typ == anyType && f.iface == nil {
+			o.buf = appendMsgpackNil(o.buf)
+			break
+		}
+		tmp := getBuffer()
+		tmp.msg = f.appendText(tmp.msg)
+		o.buf = appendMsgpackString(o.buf, tmp.message())
+		putBuffer(tmp)
+	}
+	if err != nil && !o.array {
+		o.add(String(f.Key+"Error", err.Error()))
+	}
+}
+
+// errMsgpack is returned for values readMsgpack does not know, or that
+// are larger than allowed.
+var errMsgpack = errors.New("glog: invalid msgpack")
+
+// msgpackReader reads values of at most left bytes, so that the lengths
+// sent by a peer allocate no more than that.
+type msgpackReader struct {
+	r    io.Reader
+	left int
+	b    [9]byte
+}
+
+// readMsgpack reads a value of at most limit bytes: nil, bool, int64,
+// uint64, float64, string, []byte, []interface{}, map[string]interface{}
+// or, for extensions such as EventTime, time.Time when it is type 0 of 8
+// bytes.
+func readMsgpack(r io.Reader, limit int) (interface{}, error) {
+	mr := msgpackReader{r: r, left: limit}
+	return mr.value()
+}
+
+// take accounts for n more bytes.
+func (mr *msgpackReader) take(n int) error {
+	if n > mr.left {
+		return fmt.Errorf("%w: more than %d bytes", errMsgpack, mr.left)
+	}
+	mr.left -= n
+	return nil
+}
+
+func (mr *msgpackReader) read(n int) ([]byte, error) {
+	if err := mr.take(n); err != nil {
+		return nil, err
+	}
+	p := make([]byte, n)
+	_, err := io.ReadFull(mr.r, p)
+	return p, err
+}
+
+// size reads a length of n bytes.
+func (mr *msgpackReader) size(n int) (int, error) {
+	if err := mr.take(n); err != nil {
+		return 0, err
+	}
+	b := mr.b[:n]
+	if _, err := io.ReadFull(mr.r, b); err != nil {
+		return 0, err
+	}
+	switch n {
+	case 1:
+		return int(b[0]), nil
+	case 2:
+		return int(binary.BigEndian.Uint16(b)), nil
+	}
+	return int(binary.BigEndian.Uint32(b)), nil
+}
+
+func (mr *msgpackReader) value() (interface{}, error) {
+	if err := mr.take(1); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(mr.r, mr.b[:1]); err != nil {
+		return nil, err
+	}
+
+	c := mr.b[0]
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xe0 == 0xa0:
+		p, err := mr.read(int(c & 0x1f))
+		return string(p), err
+	case c&0xf0 == 0x90:
+		return mr.array(int(c & 0x0f))
+	case c&0xf0 == 0x80:
+		return mr.mapping(int(c & 0x0f))
+	}
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2, 0xc3:
+		return c == 0xc3, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		n := 1 << (c - 0xcc)
+		p, err := mr.read(n)
+		var v uint64
+		for _, x := range p {
+			v = v<<8 | uint64(x)
+		}
+		return v, err
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		n := 1 << (c - 0xd0)
+		p, err := mr.read(n)
+		var v uint64
+		for _, x := range p {
+			v = v<<8 | uint64(x)
+		}
+		shift := 64 - 8*n
+		return int64(v<<shift) >> shift, err
+	case 0xca:
+		p, err := mr.read(4)
+		if err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(p))), nil
+	case 0xcb:
+		p, err := mr.read(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(p)), nil
+	case 0xd9, 0xda, 0xdb:
+		n, err := mr.size(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		p, err := mr.read(n)
+		return string(p), err
+	case 0xc4, 0xc5, 0xc6:
+		n, err := mr.size(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		return mr.read(n)
+	case 0xdc, 0xdd:
+		n, err := mr.size(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return mr.array(n)
+	case 0xde, 0xdf:
+		n, err := mr.size(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return mr.mapping(n)
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		p, err := mr.read(1 + 1<<(c-0xd4))
+		if err != nil {
+			return nil, err
+		}
+		if p[0] == 0 && len(p) == 9 {
+			return time.Unix(int64(binary.BigEndian.Uint32(p[1:])), int64(binary.BigEndian.Uint32(p[5:]))), nil
+		}
+		return p[1:], nil
+	}
+	return nil, fmt.Errorf("%w: type 0x%02x", errMsgpack, c)
+}
+
+// array reads n values; each takes a byte at least, which bounds n before
+// anything is allocated.
+func (mr *msgpackReader) array(n int) ([]interface{}, error) {
+	if n > mr.left {
+		return nil, fmt.Errorf("%w: more than %d bytes", errMsgpack, mr.left)
+	}
+	a := make([]interface{}, n)
+	for i := range a {
+		v, err := mr.value()
+		if err != nil {
+			return nil, err
+		}
+		a[i] = v
+	}
+	return a, nil
+}
+
+func (mr *msgpackReader) mapping(n int) (map[string]interface{}, error) {
+	if 2*n > mr.left {
+		return nil, fmt.Errorf("%w: more than %d bytes", errMsgpack, mr.left)
+	}
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		k, err := mr.value()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: map key %T", errMsgpack, k)
+		}
+		if m[key], err = mr.value(); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,398 @@
+package glog
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// errNotConnected is what a netWriter waiting to reconnect returns.
+var errNotConnected = errors.New("glog: not connected")
+
+// netWriter streams entries to a socket. Write only queues the entries,
+// up to limit bytes, the oldest dropped beyond; a goroutine of its own,
+// started by the first Write, sends them. After a failure it reconnects
+// once backoff has passed, doubled after each failure up to maxBackoff.
+type netWriter struct {
+	network      string
+	addr         string
+	tlsConfig    *tls.Config
+	frame        func(dst, p []byte) []byte       // nil writes entries as they are
+	ack          func(c net.Conn, p []byte) error // if set, waits for the peer after each write
+	hello        []byte                           // written first on each connection, answered as any write
+	dialTimeout  time.Duration
+	writeTimeout time.Duration
+	minBackoff   time.Duration
+	maxBackoff   time.Duration
+	limit        int
+	onError      func(error) // called with the errors of sending
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending [][]byte
+	size    int  // bytes in pending
+	dropped int  // entries dropped since the last error
+	busy    bool // pending[0] is being sent
+	down    bool // the last attempt failed
+	closed  bool
+	wake    chan struct{} // closed by Close, ends the wait for a retry
+	done    chan struct{} // closed when the sender is gone, nil before it starts
+	lost    int           // entries the sender gave up on closing
+
+	// used by the sender only, or by whoever calls send
+	conn    net.Conn
+	backoff time.Duration
+	retry   time.Time
+}
+
+// frameNewline ends each entry with a newline, unless it has one.
+func frameNewline(dst, p []byte) []byte {
+	dst = append(dst, p...)
+	if len(p) == 0 || p[len(p)-1] != '\n' {
+		dst = append(dst, '\n')
+	}
+	return dst
+}
+
+// frameLength puts the length of each entry in front of it, as 32 bit
+// big endian.
+func frameLength(dst, p []byte) []byte {
+	dst = binary.BigEndian.AppendUint32(dst, uint32(len(p)))
+	return append(dst, p...)
+}
+
+func (w *netWriter) connect() (err error) {
+	d := net.Dialer{Timeout: w.dialTimeout}
+	if w.tlsConfig != nil {
+		w.conn, err = tls.DialWithDialer(&d, w.network, w.addr, w.tlsConfig)
+	} else {
+		w.conn, err = d.Dial(w.network, w.addr)
+	}
+	if err != nil {
+		w.conn = nil
+		return err
+	}
+	if w.hello != nil {
+		if err = w.writeConn(w.hello); err != nil {
+			w.conn.Close()
+			w.conn = nil
+		}
+	}
+	return err
+}
+
+// fail drops the connection and puts off the next attempt.
+func (w *netWriter) fail() {
+	if w.conn != nil {
+		w.conn.Close()
+		w.conn = nil
+	}
+	if w.backoff *= 2; w.backoff < w.minBackoff {
+		w.backoff = w.minBackoff
+	} else if w.backoff > w.maxBackoff {
+		w.backoff = w.maxBackoff
+	}
+	w.retry = time.Now().Add(w.backoff)
+}
+
+func (w *netWriter) writeConn(p []byte) error {
+	if w.writeTimeout > 0 {
+		w.conn.SetWriteDeadline(time.Now().Add(w.writeTimeout))
+	}
+	_, err := w.conn.Write(p)
+	if err == nil && w.ack != nil {
+		err = w.ack(w.conn, p)
+	}
+	return err
+}
+
+// send writes msg, connecting first if need be, and returns
+// errNotConnected while a reconnect is put off. It is called by the
+// sender, or by a sink sending on a goroutine of its own, never by both.
+func (w *netWriter) send(msg []byte) error {
+	if w.conn == nil {
+		if time.Now().Before(w.retry) {
+			return errNotConnected
+		}
+		if err := w.connect(); err != nil {
+			w.fail()
+			return err
+		}
+	}
+	if err := w.writeConn(msg); err != nil {
+		w.fail()
+		return err
+	}
+	w.backoff = 0
+	return nil
+}
+
+// sleepUntil waits until t, or until wake is closed.
+func sleepUntil(t time.Time, wake chan struct{}) {
+	d := time.Until(t)
+	if d <= 0 {
+		return
+	}
+	tm := time.NewTimer(d)
+	defer tm.Stop()
+	select {
+	case <-tm.C:
+	case <-wake:
+	}
+}
+
+// sendRoutine sends the pending entries in order. The first failure after
+// a success is reported, the entries stay pending; once closed, the
+// sender makes one last attempt, whatever the backoff, and gives up.
+func (w *netWriter) sendRoutine() {
+	defer close(w.done)
+	w.mu.Lock()
+	for {
+		for len(w.pending) == 0 && !w.closed {
+			w.cond.Wait()
+		}
+		if len(w.pending) == 0 {
+			break
+		}
+		msg := w.pending[0]
+		w.busy = true
+		closed := w.closed
+		w.mu.Unlock()
+
+		if closed {
+			w.retry = time.Time{}
+		}
+		err := w.send(msg)
+		if err == errNotConnected {
+			sleepUntil(w.retry, w.wake)
+		}
+
+		w.mu.Lock()
+		w.busy = false
+		if err == nil {
+			w.size -= len(msg)
+			w.pending[0] = nil
+			w.pending = w.pending[1:]
+			w.down = false
+			w.cond.Broadcast()
+			continue
+		}
+		if err == errNotConnected {
+			continue
+		}
+		report := !w.down
+		w.down = true
+		w.cond.Broadcast()
+		if closed {
+			w.lost = len(w.pending)
+			w.pending, w.size = nil, 0
+			break
+		}
+		if report && w.onError != nil {
+			w.mu.Unlock()
+			w.onError(err)
+			w.mu.Lock()
+		}
+	}
+	if w.conn != nil {
+		w.conn.Close()
+		w.conn = nil
+	}
+	w.cond.Broadcast()
+	w.mu.Unlock()
+}
+
+// keep adds a framed entry to the pending ones, dropping the oldest
+// beyond limit, but the one being sent. It is called with mu held.
+func (w *netWriter) keep(msg []byte) {
+	if len(msg) > w.limit {
+		w.dropped++
+		return
+	}
+	w.pending = append(w.pending, msg)
+	w.size += len(msg)
+	i := 0
+	if w.busy {
+		i = 1
+	}
+	for w.size > w.limit && len(w.pending) > i {
+		w.size -= len(w.pending[i])
+		copy(w.pending[i:], w.pending[i+1:])
+		w.pending[len(w.pending)-1] = nil
+		w.pending = w.pending[:len(w.pending)-1]
+		w.dropped++
+	}
+}
+
+func (w *netWriter) Write(p []byte) (int, error) {
+	var msg []byte
+	if w.frame != nil {
+		msg = w.frame(nil, p)
+	} else {
+		msg = append([]byte(nil), p...)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, fmt.Errorf("glog: %s %s closed", w.network, w.addr)
+	}
+	if w.done == nil {
+		w.done = make(chan struct{})
+		go w.sendRoutine()
+	}
+	w.keep(msg)
+	w.cond.Broadcast()
+	if w.dropped > 0 {
+		err := fmt.Errorf("glog: %s %s unreachable, %d entries dropped", w.network, w.addr, w.dropped)
+		w.dropped = 0
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush waits until the pending entries are sent, or until sending them
+// failed: then they are kept for the next attempt.
+func (w *netWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for len(w.pending) > 0 && !w.down && w.done != nil {
+		w.cond.Wait()
+	}
+	return nil
+}
+
+// Close lets the sender make one last attempt at the pending entries,
+// whatever the backoff, and closes the connection.
+func (w *netWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	close(w.wake)
+	w.cond.Broadcast()
+	done := w.done
+	w.mu.Unlock()
+	if done == nil {
+		// nothing was written, or a sink sent by itself
+		if w.conn != nil {
+			w.conn.Close()
+			w.conn = nil
+		}
+		return nil
+	}
+	<-done
+	if w.lost > 0 {
+		return fmt.Errorf("glog: %s %s unreachable, %d entries lost", w.network, w.addr, w.lost)
+	}
+	return nil
+}
+
+// newNetWriter returns a netWriter configured by options, see
+// createNetLogger; the framing is left to the caller.
+func newNetWriter(options map[string]interface{}) *netWriter {
+	w := &netWriter{
+		network:      "tcp",
+		dialTimeout:  5 * time.Second,
+		writeTimeout: 5 * time.Second,
+		minBackoff:   100 * time.Millisecond,
+		maxBackoff:   30 * time.Second,
+		limit:        1 << 20,
+		wake:         make(chan struct{}),
+	}
+	w.cond = sync.NewCond(&w.mu)
+	if s, ok := options["network"].(string); ok && s != "" {
+		w.network = s
+	}
+	w.addr, _ = options["addr"].(string)
+	w.tlsConfig, _ = options["tls"].(*tls.Config)
+	if d, ok := options["dialTimeout"].(time.Duration); ok && d > 0 {
+		w.dialTimeout = d
+	}
+	if d, ok := options["writeTimeout"].(time.Duration); ok {
+		w.writeTimeout = d
+	}
+	if d, ok := options["backoff"].(time.Duration); ok && d > 0 {
+		w.minBackoff = d
+	}
+	if d, ok := options["maxBackoff"].(time.Duration); ok && d > 0 {
+		w.maxBackoff = d
+	}
+	if w.maxBackoff < w.minBackoff {
+		w.maxBackoff = w.minBackoff
+	}
+	if n, ok := options["pendingBytes"].(int); ok {
+		w.limit = n
+	}
+	w.onError, _ = options["onError"].(func(error))
+	return w
+}
+
+// stream reports whether the network carries a stream rather than
+// datagrams, which need no framing.
+func (w *netWriter) stream() bool {
+	switch w.network {
+	case "udp", "udp4", "udp6", "unixgram":
+		return false
+	}
+	return true
+}
+
+// createNetLogger returns a Logger streaming its entries to a socket.
+//
+// options:
+//
+//	network: string, "tcp" (default), "udp", "unix" or "unixgram"
+//	addr: string, host:port or the socket path
+//	framing: string, on streams "newline" (default) ends each entry with
+//	         a newline, "length" puts its length in front, as 32 bit big
+//	         endian; datagrams hold one entry each
+//	tls: *tls.Config, for TLS over tcp
+//	dialTimeout: time.Duration, 5s by default
+//	writeTimeout: time.Duration, 5s by default, 0 for none
+//	backoff: time.Duration, the wait before reconnecting, 100ms by
+//	         default, doubled after each failure
+//	maxBackoff: time.Duration, 30s by default
+//	pendingBytes: int, how much may wait to be sent, 1MB by default; the
+//	              oldest entries are dropped beyond it
+//	flag: int, Lshortfile or Llongfile put the caller before the message
+//	and the Logger options, see setOptions, but buffered: every entry is
+//	written on its own
+//
+// The entries are sent by a goroutine of their own, logging never waits
+// for the network; Flush and Close do.
+func createNetLogger(options map[string]interface{}) *Logger {
+	w := newNetWriter(options)
+	if w.addr == "" {
+		log.Printf("net addr [] invalid, must be host:port or a socket path\n")
+	}
+	if w.stream() {
+		w.frame = frameNewline
+		if s, ok := options["framing"].(string); ok {
+			switch s {
+			case "newline":
+			case "length":
+				w.frame = frameLength
+			default:
+				log.Printf("framing [%s] invalid, must be newline or length, set to newline\n", s)
+			}
+		}
+	}
+
+	flag, _ := options["flag"].(int)
+	l := &Logger{flag: int32(flag)}
+	l.prefix.Store(prefixFn)
+	l.out.out = make(map[int]io.WriteCloser)
+	for i := DebugLevel; i < LevelCount; i++ {
+		l.out.out[i] = w
+	}
+	l.setOptions(withoutOptions(options, "buffered"))
+	return l
+}
@@ -0,0 +1,205 @@
+package glog
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"io"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// accept hands the connections made to ln to the channel, after the TLS
+// handshake: the client waits for it in Dial.
+func accept(ln net.Listener) chan net.Conn {
+	ch := make(chan net.Conn, 4)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				close(ch)
+				return
+			}
+			if tc, ok := c.(*tls.Conn); ok {
+				tc.Handshake()
+			}
+			ch <- c
+		}
+	}()
+	return ch
+}
+
+func TestNetWriter(t *testing.T) {
+	// take an address, then leave it unserved
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	errs := make(chan error, 10)
+	l := createNetLogger(map[string]interface{}{
+		"addr": addr, "backoff": 10 * time.Millisecond,
+		"onError": func(err error) { errs <- err },
+	})
+	defer l.Close()
+	l.Info("one")
+	l.Info("two")
+	<-errs
+	time.Sleep(50 * time.Millisecond)
+	if len(errs) != 0 {
+		t.Fatalf("a failed dial should be reported once, got %v", <-errs)
+	}
+
+	// kept while disconnected, sent in order once the collector is up
+	if ln, err = net.Listen("tcp", addr); err != nil {
+		t.Skip(err)
+	}
+	defer ln.Close()
+	conns := accept(ln)
+	r := bufio.NewReader(<-conns)
+	l.Info("three")
+	l.Flush()
+	for _, want := range []string{"INFO one", "INFO two", "INFO three"} {
+		line, err := r.ReadString('\n')
+		if err != nil || strings.TrimSpace(line) != want {
+			t.Errorf("got %q, %v, want %q", line, err, want)
+		}
+	}
+}
+
+func TestNetWriterBounded(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	errs := make(chan error, 10)
+	l := createNetLogger(map[string]interface{}{
+		"addr": addr, "backoff": time.Hour, "pendingBytes": 24,
+		"onError": func(err error) { errs <- err },
+	})
+	// the sender waits for the retry with four, logging goes on
+	l.Info("four")
+	<-errs
+	start := time.Now()
+	l.Info("five")
+	l.Info("six")
+	l.Flush()
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("logging waited %v for the network", d)
+	}
+
+	// beyond pendingBytes the oldest entries are dropped, but the one
+	// being sent
+	if err := <-errs; !strings.Contains(err.Error(), "1 entries dropped") {
+		t.Errorf("got %v, want one drop", err)
+	}
+	w := l.out.out[InfoLevel].(*netWriter)
+	w.mu.Lock()
+	if len(w.pending) != 2 || string(w.pending[0]) != "INFO four\n" || string(w.pending[1]) != "INFO six\n" {
+		t.Errorf("pending %q, want four and six", w.pending)
+	}
+	w.mu.Unlock()
+	if err := w.Close(); err == nil || !strings.Contains(err.Error(), "2 entries lost") {
+		t.Errorf("close: %v", err)
+	}
+}
+
+func TestNetWriterStalled(t *testing.T) {
+	// a collector that takes the connection and reads nothing
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer ln.Close()
+	conns := accept(ln)
+	l := createNetLogger(map[string]interface{}{
+		"addr": ln.Addr().String(), "writeTimeout": time.Duration(0),
+	})
+	start := time.Now()
+	big := strings.Repeat("x", 64<<10)
+	for i := 0; i < 200; i++ {
+		l.Info("%s", big)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("logging waited %v for the network", d)
+	}
+	(<-conns).Close()
+	l.Close()
+}
+
+func TestNetWriterFraming(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer ln.Close()
+	conns := accept(ln)
+	l := createNetLogger(map[string]interface{}{
+		"addr": ln.Addr().String(), "framing": "length", "encoding": "json",
+	})
+	defer l.Close()
+	l.Warn("multi\nline")
+	c := <-conns
+	var size [4]byte
+	if _, err = io.ReadFull(c, size[:]); err != nil {
+		t.Fatal(err)
+	}
+	p := make([]byte, binary.BigEndian.Uint32(size[:]))
+	if _, err = io.ReadFull(c, p); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(p), `"msg":"multi\nline"`) {
+		t.Errorf("got %q", p)
+	}
+}
+
+func TestNetWriterTLS(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	})
+	if err != nil {
+		t.Skip(err)
+	}
+	defer ln.Close()
+	conns := accept(ln)
+	l := createNetLogger(map[string]interface{}{
+		"addr": ln.Addr().String(), "tls": &tls.Config{RootCAs: pool},
+		"onError": func(err error) { t.Error(err) },
+	})
+	defer l.Close()
+	l.Error("secret")
+	line, err := bufio.NewReader(<-conns).ReadString('\n')
+	if err != nil || line != "ERROR secret\n" {
+		t.Errorf("got %q, %v", line, err)
+	}
+}
@@ -1,144 +1,584 @@
 package glog
 
-/*
 import (
+	"encoding/binary"
+	"encoding/json"
 	"errors"
-	nsq "github.com/bitly/go-nsq"
+	"fmt"
 	"io"
+	"log"
 	"net"
-	//"syscall"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 )
 
-type nsqLogger struct {
-	Logger
+// The NSQ TCP protocol, as far as publishing needs it: the magic and an
+// IDENTIFY, then PUB and MPUB commands, each answered by a frame.
+const (
+	nsqMagic         = "  V2"
+	nsqFrameResponse = 0
+	nsqFrameError    = 1
+	nsqHeartbeat     = "_heartbeat_"
+)
+
+// nsqHello returns the magic and an IDENTIFY turning heartbeats off:
+// between batches nobody would answer them.
+func nsqHello() []byte {
+	body, _ := json.Marshal(map[string]interface{}{
+		"client_id":          program,
+		"hostname":           host,
+		"user_agent":         "glog",
+		"heartbeat_interval": -1,
+	})
+	hello := append([]byte(nsqMagic), "IDENTIFY\n"...)
+	hello = binary.BigEndian.AppendUint32(hello, uint32(len(body)))
+	return append(hello, body...)
+}
 
-	localAddr string
+// appendNsqPub appends a PUB of one message, or an MPUB of n, msgs being
+// for each a 32 bit big endian length and the message.
+func appendNsqPub(dst []byte, topic string, msgs []byte, n int) []byte {
+	if n == 1 {
+		dst = append(dst, "PUB "...)
+		dst = append(dst, topic...)
+		dst = append(dst, '\n')
+		return append(dst, msgs...)
+	}
+	dst = append(dst, "MPUB "...)
+	dst = append(dst, topic...)
+	dst = append(dst, '\n')
+	dst = binary.BigEndian.AppendUint32(dst, uint32(4+len(msgs)))
+	dst = binary.BigEndian.AppendUint32(dst, uint32(n))
+	return append(dst, msgs...)
+}
 
-	rtSeconds int64
-	rtItems   int64
-	rtNbytes  int64
+// nsqResponse waits for the answer of nsqd to the IDENTIFY, a PUB or an
+// MPUB, answering heartbeats on the way.
+func nsqResponse(timeout time.Duration) func(c net.Conn, p []byte) error {
+	return func(c net.Conn, p []byte) error {
+		var hdr [8]byte
+		for {
+			c.SetReadDeadline(time.Now().Add(timeout))
+			if _, err := io.ReadFull(c, hdr[:]); err != nil {
+				return err
+			}
+			size := binary.BigEndian.Uint32(hdr[:4])
+			if size < 4 || size > 1<<20 {
+				return fmt.Errorf("glog: nsqd frame of %d bytes", size)
+			}
+			data := make([]byte, size-4)
+			if _, err := io.ReadFull(c, data); err != nil {
+				return err
+			}
+			switch typ := binary.BigEndian.Uint32(hdr[4:]); {
+			case typ == nsqFrameResponse && string(data) == nsqHeartbeat:
+				if _, err := c.Write([]byte("NOP\n")); err != nil {
+					return err
+				}
+			case typ == nsqFrameResponse:
+				return nil
+			case typ == nsqFrameError:
+				return fmt.Errorf("glog: nsqd: %s", data)
+			default:
+				return fmt.Errorf("glog: nsqd frame type %d", typ)
+			}
+		}
+	}
 }
 
+// nsqBatch holds the length-prefixed messages of one topic.
+type nsqBatch struct {
+	msgs []byte
+	n    int
+}
+
+// nsqWriter publishes entries to nsqd, one topic per level. Entries are
+// batched into MPUBs, up to batchSize entries or batchBytes, and at least
+// every flushInterval. The commands are sent by a goroutine of their own,
+// through w; those waiting are kept up to w.limit bytes, the oldest
+// dropped beyond. While nsqd is unavailable they go to the spool file,
+// if there is one, and are sent again from there, at least once.
 type nsqWriter struct {
-	*nsq.Producer
-	chn string
+	mu         sync.Mutex
+	cond       *sync.Cond
+	w          *netWriter
+	topics     [LevelCount]string
+	batches    [LevelCount]nsqBatch
+	batchSize  int
+	batchBytes int
+	onError    func(error)
+
+	queue   [][]byte // the commands for the sender
+	queued  int      // bytes in queue
+	dropped int      // commands dropped since the last error
+	busy    bool     // queue[0] or the spool is being sent
+	down    bool     // the last attempt failed
+	spooled bool     // the spool holds commands
+	closed  bool
+	stop    chan struct{} // ends the flushRoutine
+	wake    chan struct{} // closed by Close, ends the wait for a retry
+	done    chan struct{} // closed when the sender is gone
+	lost    int           // commands the sender gave up on closing
+
+	// used by the sender only
+	spool      *os.File
+	spoolOff   int64 // what was sent of the spool
+	spoolLimit int64
 }
 
-func (nl *nsqLogger) Close() {
-	for i := DebugLevel; i < LevelCount; i++ {
-		nl.out.out[i].Close()
+// nsqTopicWriter is the writer of one level, and so of one topic.
+type nsqTopicWriter struct {
+	nw *nsqWriter
+	lv int
+}
+
+func (tw nsqTopicWriter) Write(p []byte) (int, error) {
+	return tw.nw.add(tw.lv, p)
+}
+
+func (tw nsqTopicWriter) Flush() error {
+	return tw.nw.Flush()
+}
+
+func (tw nsqTopicWriter) Close() error {
+	return tw.nw.Close()
+}
+
+func (nw *nsqWriter) add(lv int, p []byte) (int, error) {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	if nw.closed {
+		return 0, fmt.Errorf("glog: nsq %s closed", nw.w.addr)
+	}
+	b := &nw.batches[lv]
+	b.msgs = binary.BigEndian.AppendUint32(b.msgs, uint32(len(p)))
+	b.msgs = append(b.msgs, p...)
+	b.n++
+	if b.n >= nw.batchSize || len(b.msgs) >= nw.batchBytes {
+		nw.enqueue(lv)
 	}
+	if nw.dropped > 0 {
+		err := fmt.Errorf("glog: nsq %s behind, %d commands dropped", nw.w.addr, nw.dropped)
+		nw.dropped = 0
+		return 0, err
+	}
+	return len(p), nil
 }
 
-// options:
-//   nsqdAddr: string, host:port
-//   localAddr: string
-//   device_id: int
-func createNsqLogger(options map[string]interface{}) *nsqLogger {
+// enqueue hands the batch of level lv to the sender, as a PUB or an
+// MPUB. It is called with mu held.
+func (nw *nsqWriter) enqueue(lv int) {
+	b := &nw.batches[lv]
+	if b.n == 0 {
+		return
+	}
+	cmd := appendNsqPub(nil, nw.topics[lv], b.msgs, b.n)
+	b.msgs, b.n = b.msgs[:0], 0
+	nw.queue = append(nw.queue, cmd)
+	nw.queued += len(cmd)
+	i := 0
+	if nw.busy {
+		i = 1
+	}
+	for nw.queued > nw.w.limit && len(nw.queue) > i {
+		nw.queued -= len(nw.queue[i])
+		copy(nw.queue[i:], nw.queue[i+1:])
+		nw.queue[len(nw.queue)-1] = nil
+		nw.queue = nw.queue[:len(nw.queue)-1]
+		nw.dropped++
+	}
+	nw.cond.Broadcast()
+}
+
+// sendRoutine sends the spool, then the queue. After a failure the
+// queue goes to the spool, if there is one, and the first failure after
+// a success is reported; once closed, the sender makes one last attempt,
+// whatever the backoff, and leaves the rest in the spool.
+func (nw *nsqWriter) sendRoutine() {
+	defer close(nw.done)
+	nw.mu.Lock()
+	for {
+		for len(nw.queue) == 0 && !nw.spooled && !nw.closed {
+			nw.cond.Wait()
+		}
+		if len(nw.queue) == 0 && !nw.spooled {
+			break
+		}
+		closed := nw.closed
+		nw.busy = true
+		nw.mu.Unlock()
+
+		if closed {
+			nw.w.retry = time.Time{}
+		}
+		var err error
+		if nw.spool != nil {
+			err = nw.replay()
+		}
+		nw.mu.Lock()
+		nw.spooled = nw.spool != nil && nw.spoolSize() > 0
+		if err == nil && len(nw.queue) > 0 {
+			cmd := nw.queue[0]
+			nw.mu.Unlock()
+			err = nw.w.send(cmd)
+			nw.mu.Lock()
+			if err == nil {
+				nw.queued -= len(cmd)
+				nw.queue[0] = nil
+				nw.queue = nw.queue[1:]
+			}
+		}
+		nw.busy = false
+		if err == nil {
+			nw.down = false
+			nw.cond.Broadcast()
+			continue
+		}
+
+		report := !nw.down && err != errNotConnected
+		nw.down = true
+		var queue [][]byte
+		if nw.spool != nil || closed {
+			queue = nw.queue
+			nw.queue, nw.queued = nil, 0
+		}
+		nw.cond.Broadcast()
+		nw.mu.Unlock()
+
+		var errs []error
+		if report {
+			errs = append(errs, err)
+		}
+		if nw.spool != nil {
+			for _, cmd := range queue {
+				if serr := nw.spoolCmd(cmd); serr != nil {
+					errs = append(errs, serr)
+				}
+			}
+		} else if len(queue) > 0 {
+			nw.lost = len(queue)
+		}
+		if nw.onError != nil {
+			for _, err := range errs {
+				nw.onError(err)
+			}
+		}
+		if err == errNotConnected && !closed {
+			sleepUntil(nw.w.retry, nw.wake)
+		}
+
+		nw.mu.Lock()
+		nw.spooled = nw.spool != nil && nw.spoolSize() > 0
+		if closed {
+			break
+		}
+	}
+	nw.w.Close()
+	if nw.spool != nil {
+		nw.spool.Close()
+	}
+	nw.cond.Broadcast()
+	nw.mu.Unlock()
+}
+
+// spoolSize returns the size of the spool, 0 if it can not be known.
+func (nw *nsqWriter) spoolSize() int64 {
+	fi, err := nw.spool.Stat()
+	if err != nil {
+		return 0
+	}
+	return fi.Size()
+}
+
+// spoolCmd appends a command to the spool, as its 32 bit big endian
+// length and the command.
+func (nw *nsqWriter) spoolCmd(cmd []byte) error {
+	if nw.spoolSize()+4+int64(len(cmd)) > nw.spoolLimit {
+		return fmt.Errorf("glog: nsq spool %s full, %d bytes dropped", nw.spool.Name(), len(cmd))
+	}
+	rec := binary.BigEndian.AppendUint32(make([]byte, 0, 4+len(cmd)), uint32(len(cmd)))
+	_, err := nw.spool.Write(append(rec, cmd...))
+	return err
+}
+
+// replay sends the commands in the spool, and empties it once all went.
+// If it stops short, what went is cut off the spool, so that the next run
+// does not send it again. A torn record, such as one cut short by a
+// crash, is dropped with what follows.
+func (nw *nsqWriter) replay() error {
+	size := nw.spoolSize()
 	var (
-		ok        bool
-		err       error
-		flag      int
-		nsqdAddr  string
-		localAddr string
+		hdr [4]byte
+		err error
 	)
-	if flag, ok = options["flag"].(int); !ok {
-		flag = Ldate | Ltime
+	for nw.spoolOff < size {
+		n := int64(-1)
+		if _, err = nw.spool.ReadAt(hdr[:], nw.spoolOff); err == nil {
+			n = int64(binary.BigEndian.Uint32(hdr[:]))
+		}
+		if n < 0 || n > nw.spoolLimit || nw.spoolOff+4+n > size {
+			if nw.onError != nil {
+				nw.onError(fmt.Errorf("glog: nsq spool %s torn at %d, %d bytes dropped", nw.spool.Name(), nw.spoolOff, size-nw.spoolOff))
+			}
+			size = nw.spoolOff
+			break
+		}
+		cmd := make([]byte, n)
+		if _, err = nw.spool.ReadAt(cmd, nw.spoolOff+4); err != nil {
+			break
+		}
+		if err = nw.w.send(cmd); err != nil {
+			break
+		}
+		nw.spoolOff += 4 + n
 	}
-
-	if localAddr, ok = options["localAddr"].(string); !ok {
-		localAddr, err = getLocalAddr()
-		if err != nil {
-			panic("get local address failed\n")
+	if err == nil && nw.spoolOff >= size {
+		nw.spoolOff = 0
+		return nw.spool.Truncate(0)
+	}
+	if nw.spoolOff > 0 {
+		if cerr := nw.compact(); cerr != nil && nw.onError != nil {
+			nw.onError(cerr)
 		}
 	}
-	nl := &nsqLogger{
-		Logger{
-			flag: flag,
-		},
-		localAddr,
-		0, 0, 0,
+	return err
+}
+
+// compact drops what was sent of the spool: the rest is copied to a new
+// file, which replaces it.
+func (nw *nsqWriter) compact() error {
+	name := nw.spool.Name()
+	f, err := os.OpenFile(name+".tmp", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, io.NewSectionReader(nw.spool, nw.spoolOff, nw.spoolSize()-nw.spoolOff))
+	if err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
 	}
+	if err == nil {
+		err = os.Rename(name+".tmp", name)
+	}
+	if err != nil {
+		os.Remove(name + ".tmp")
+		return err
+	}
+	if f, err = os.OpenFile(name, os.O_RDWR|os.O_APPEND, 0644); err != nil {
+		return err
+	}
+	nw.spool.Close()
+	nw.spool, nw.spoolOff = f, 0
+	return nil
+}
 
-	if nsqdAddr, ok = options["nsqdAddr"].(string); !ok {
-		panic("options[\"nsqdAddr\" must be string\n")
+// Flush hands the batches to the sender and waits until it sent them, or
+// failed to.
+func (nw *nsqWriter) Flush() error {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	for lv := range nw.batches {
+		nw.enqueue(lv)
+	}
+	for (len(nw.queue) > 0 || nw.spooled || nw.busy) && !nw.down && !nw.closed {
+		nw.cond.Wait()
 	}
+	return nil
+}
 
-	nl.buildNsqChannel(nsqdAddr)
+func (nw *nsqWriter) flushRoutine(interval time.Duration) {
+	tk := time.NewTicker(interval)
+	defer tk.Stop()
+	for {
+		select {
+		case <-tk.C:
+			nw.mu.Lock()
+			for lv := range nw.batches {
+				nw.enqueue(lv)
+			}
+			nw.mu.Unlock()
+		case <-nw.stop:
+			return
+		}
+	}
+}
 
-	return nl
+// Close publishes the batches and closes the connection; what is left
+// stays in the spool for the next run. The writers of all levels share
+// nw, only the first Close does anything.
+func (nw *nsqWriter) Close() error {
+	nw.mu.Lock()
+	if nw.closed {
+		nw.mu.Unlock()
+		return nil
+	}
+	for lv := range nw.batches {
+		nw.enqueue(lv)
+	}
+	nw.closed = true
+	close(nw.stop)
+	close(nw.wake)
+	nw.cond.Broadcast()
+	nw.mu.Unlock()
+	<-nw.done
+	if nw.lost > 0 {
+		return fmt.Errorf("glog: nsq %s unreachable, %d commands lost", nw.w.addr, nw.lost)
+	}
+	return nil
 }
 
-// 获得本机网卡ip地址
+// getLocalAddr returns the IP address of the first interface that is up
+// and not a loopback.
 func getLocalAddr() (string, error) {
 	is, err := net.Interfaces()
 	if err != nil {
 		return "", err
 	}
-
 	for _, card := range is {
-		// 网卡没有up
-		if card.Flags&net.FlagUp == 0 {
-			continue
-		}
-		// loopback地址
-		if card.Flags&net.FlagLoopback != 0 {
+		if card.Flags&net.FlagUp == 0 || card.Flags&net.FlagLoopback != 0 {
 			continue
 		}
 		addrs, err := card.Addrs()
-		if err != nil {
+		if err != nil || len(addrs) == 0 {
 			continue
 		}
+		if ipn, ok := addrs[0].(*net.IPNet); ok {
+			return ipn.IP.String(), nil
+		}
 		return addrs[0].String(), nil
 	}
-
 	return "", errors.New("Not found proper interface address.")
 }
 
-// 建立于nsq server
-func (nl *nsqLogger) buildNsqChannel(nsqdAddr string) {
-	var err error
-
-	nl.out.prefix = map[int]string{
-		DebugLevel: "DEBUG",
-		InfoLevel:  "INFO",
-		WarnLevel:  "WARN",
-		ErrorLevel: "ERROR",
-		FatalLevel: "FATAL",
-		PanicLevel: "PANIC",
+// nsqTopic expands the topic template of level lv and replaces what NSQ
+// does not allow in a topic name by underscores.
+func nsqTopic(format string, lv int, localAddr string) string {
+	s := strings.Replace(format, "{{level}}", levelName(lv), -1)
+	s = strings.Replace(s, "{{addr}}", localAddr, -1)
+	s = strings.Replace(s, "{{host}}", host, -1)
+	s = strings.Replace(s, "{{program}}", program, -1)
+	ephemeral := strings.HasSuffix(s, "#ephemeral")
+	s = strings.TrimSuffix(s, "#ephemeral")
+	b := []byte(s)
+	for i, c := range b {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '_' || c == '-') {
+			b[i] = '_'
+		}
+	}
+	max := 64
+	if ephemeral {
+		max -= len("#ephemeral")
 	}
+	if len(b) > max {
+		b = b[:max]
+	}
+	if ephemeral {
+		b = append(b, "#ephemeral"...)
+	}
+	return string(b)
+}
 
-	nl.out.out = make(map[int]io.WriteCloser)
+// createNsqLogger returns a Logger publishing its entries to nsqd.
+//
+// options:
+//
+//	nsqdAddr: string, host:port of nsqd, 127.0.0.1:4150 by default
+//	localAddr: string, the address in the topics, the first one of this
+//	           host by default
+//	topic: string, the topic of each level, "{{level}}-{{addr}}" by
+//	       default; {{level}}, {{addr}}, {{host}} and {{program}} are
+//	       replaced, what a topic can not hold becomes an underscore
+//	batchSize: int, the most entries of an MPUB, 100 by default
+//	batchBytes: int, a batch is sent once this large, 512KB by default
+//	flushInterval: time.Duration, the longest a batch waits, 1s by default
+//	ackTimeout: time.Duration, how long to wait for nsqd, 5s by default
+//	spool: string, a directory to keep what nsqd can not take in, until it
+//	       can, across restarts; without it that is kept in memory
+//	spoolBytes: int, the largest spool file, 64MB by default
+//	the options of the net sink, see createNetLogger, but network, addr
+//	and framing
+//	and the Logger options, see setOptions, but buffered
+func createNsqLogger(options map[string]interface{}) *Logger {
+	w := newNetWriter(withoutOptions(options, "network"))
+	w.network = "tcp"
+	if w.addr, _ = options["nsqdAddr"].(string); w.addr == "" {
+		log.Printf("nsqdAddr [] invalid, set to 127.0.0.1:4150\n")
+		w.addr = "127.0.0.1:4150"
+	}
+	w.hello = nsqHello()
+	timeout, ok := options["ackTimeout"].(time.Duration)
+	if !ok || timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	w.ack = nsqResponse(timeout)
 
-	for i := DebugLevel; i < LevelCount; i++ {
-		nl.out.out[i], err = nl.openPublisher(nsqdAddr, i)
+	nw := &nsqWriter{
+		w:          w,
+		batchSize:  100,
+		batchBytes: 512 << 10,
+		stop:       make(chan struct{}),
+		wake:       make(chan struct{}),
+		done:       make(chan struct{}),
+		spoolLimit: 64 << 20,
+	}
+	nw.cond = sync.NewCond(&nw.mu)
+	if n, ok := options["batchSize"].(int); ok && n > 0 {
+		nw.batchSize = n
+	}
+	if n, ok := options["batchBytes"].(int); ok && n > 0 {
+		nw.batchBytes = n
+	}
+	if n, ok := options["spoolBytes"].(int); ok && n > 0 {
+		nw.spoolLimit = int64(n)
+	}
+	if dir, ok := options["spool"].(string); ok && dir != "" {
+		f, err := os.OpenFile(filepath.Join(dir, program+".nsq"), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
 		if err != nil {
-			panic("open nsq publisher failed!")
+			log.Printf("spool [%s] invalid: %v, entries are kept in memory\n", dir, err)
+		} else {
+			nw.spool = f
+			nw.spooled = nw.spoolSize() > 0
 		}
 	}
-}
-
-func (nl *nsqLogger) openPublisher(nsqdAddr string, level int) (io.WriteCloser, error) {
-	conf := nsq.NewConfig()
 
-	chn := nl.out.prefix[level] + "-" + nl.localAddr
-	p, err := nsq.NewProducer(nsqdAddr, conf)
-	if err != nil {
-		println("create producer " + chn + " failed")
-		return nil, err
+	localAddr, ok := options["localAddr"].(string)
+	if !ok {
+		var err error
+		if localAddr, err = getLocalAddr(); err != nil {
+			log.Printf("get local address failed: %v, set to %s\n", err, host)
+			localAddr = host
+		}
+	}
+	format, _ := options["topic"].(string)
+	if format == "" {
+		format = "{{level}}-{{addr}}"
+	}
+	for lv := range nw.topics {
+		nw.topics[lv] = nsqTopic(format, lv, localAddr)
 	}
-	n := &nsqWriter{p, chn}
-	return n, nil
-}
 
-// nsqWrite implement io.WriteCloser
-func (nw *nsqWriter) Write(data []byte) (n int, err error) {
-	err = nw.Publish(nw.chn, data)
-	return len(data), err
-}
+	flag, ok := options["flag"].(int)
+	if !ok {
+		flag = Ldate | Ltime
+	}
+	l := &Logger{flag: int32(flag)}
+	l.prefix.Store(prefixFn)
+	l.out.out = make(map[int]io.WriteCloser)
+	for i := DebugLevel; i < LevelCount; i++ {
+		l.out.out[i] = nsqTopicWriter{nw, i}
+	}
+	l.setOptions(withoutOptions(options, "buffered"))
+	nw.onError = l.onError
 
-func (nw *nsqWriter) Close() error {
-	nw.Stop()
-	return nil
+	interval, ok := options["flushInterval"].(time.Duration)
+	if !ok || interval <= 0 {
+		interval = time.Second
+	}
+	go nw.sendRoutine()
+	go nw.flushRoutine(interval)
+	return l
 }
-*/
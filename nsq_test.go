@@ -0,0 +1,269 @@
+package glog
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// nsqPub is a PUB or MPUB as the fake nsqd got it.
+type nsqPub struct {
+	topic string
+	msgs  []string
+}
+
+// fakeNsqd speaks enough of the NSQ TCP protocol for publishing. It sends
+// a heartbeat before the first answer of each connection, and fails the
+// PUBs of reject.
+type fakeNsqd struct {
+	ln     net.Listener
+	pubs   chan nsqPub
+	reject string
+}
+
+func newFakeNsqd(t *testing.T, addr string) *fakeNsqd {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Skip(err)
+	}
+	f := &fakeNsqd{ln: ln, pubs: make(chan nsqPub, 100)}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(t, c)
+		}
+	}()
+	return f
+}
+
+func (f *fakeNsqd) frame(c net.Conn, typ uint32, data string) {
+	b := binary.BigEndian.AppendUint32(nil, uint32(4+len(data)))
+	b = binary.BigEndian.AppendUint32(b, typ)
+	c.Write(append(b, data...))
+}
+
+func (f *fakeNsqd) serve(t *testing.T, c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != nsqMagic {
+		t.Errorf("magic %q, %v", magic, err)
+		return
+	}
+	read := func(n uint32) []byte {
+		p := make([]byte, n)
+		io.ReadFull(r, p)
+		return p
+	}
+	heartbeat := true
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.Fields(line)
+		switch cmd[0] {
+		case "NOP":
+			continue
+		case "IDENTIFY":
+			var id map[string]interface{}
+			json.Unmarshal(read(binary.BigEndian.Uint32(read(4))), &id)
+			if id["heartbeat_interval"] != -1.0 {
+				t.Errorf("IDENTIFY %v", id)
+			}
+		case "PUB":
+			msg := string(read(binary.BigEndian.Uint32(read(4))))
+			if msg == f.reject && msg != "" {
+				f.frame(c, nsqFrameError, "E_PUB_FAILED")
+				continue
+			}
+			f.pubs <- nsqPub{cmd[1], []string{msg}}
+		case "MPUB":
+			read(4)
+			pub := nsqPub{topic: cmd[1]}
+			for n := binary.BigEndian.Uint32(read(4)); n > 0; n-- {
+				pub.msgs = append(pub.msgs, string(read(binary.BigEndian.Uint32(read(4)))))
+			}
+			f.pubs <- pub
+		default:
+			t.Errorf("command %q", line)
+			return
+		}
+		if heartbeat {
+			f.frame(c, nsqFrameResponse, nsqHeartbeat)
+			heartbeat = false
+		}
+		f.frame(c, nsqFrameResponse, "OK")
+	}
+}
+
+func (f *fakeNsqd) next(t *testing.T) nsqPub {
+	select {
+	case p := <-f.pubs:
+		return p
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing published")
+	}
+	return nsqPub{}
+}
+
+func TestNsqTopic(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"{{level}}-{{addr}}", "INFO-192.168.1.2"},
+		{"{{level}}-fe80::1", "INFO-fe80__1"},
+		{"logs #{{level}}#ephemeral", "logs__INFO#ephemeral"},
+		{strings.Repeat("x", 70), strings.Repeat("x", 64)},
+	}
+	for _, tt := range tests {
+		if got := nsqTopic(tt.format, InfoLevel, "192.168.1.2"); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestNsq(t *testing.T) {
+	f := newFakeNsqd(t, "127.0.0.1:0")
+	defer f.ln.Close()
+	l := createNsqLogger(map[string]interface{}{
+		"nsqdAddr": f.ln.Addr().String(), "topic": "app-{{level}}", "flag": 0,
+		"batchSize": 2, "flushInterval": time.Hour,
+	})
+	defer l.Close()
+	l.Info("one")
+	l.Info("two")
+	if p := f.next(t); p.topic != "app-INFO" || len(p.msgs) != 2 || p.msgs[0] != "INFO one\n" || p.msgs[1] != "INFO two\n" {
+		t.Errorf("got %q", p)
+	}
+	l.Info("three")
+	l.Error("four")
+	l.Flush()
+	got := map[string][]string{}
+	for i := 0; i < 2; i++ {
+		p := f.next(t)
+		got[p.topic] = p.msgs
+	}
+	if len(got["app-INFO"]) != 1 || got["app-INFO"][0] != "INFO three\n" || len(got["app-ERROR"]) != 1 {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestNsqSpool(t *testing.T) {
+	// take an address, then leave it unserved
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	dir := t.TempDir()
+	options := map[string]interface{}{
+		"nsqdAddr": addr, "topic": "app", "flag": 0, "spool": dir,
+		"batchSize": 1, "flushInterval": time.Hour, "backoff": time.Millisecond,
+	}
+	var errs []error
+	options["onError"] = func(err error) { errs = append(errs, err) }
+	l := createNsqLogger(options)
+	l.Info("one")
+	l.Info("two")
+	l.Close()
+	if len(errs) != 1 {
+		t.Errorf("a failed dial should be reported once, got %v", errs)
+	}
+	spool := filepath.Join(dir, program+".nsq")
+	if fi, err := os.Stat(spool); err != nil || fi.Size() == 0 {
+		t.Fatalf("spool: %v, %v", fi, err)
+	}
+
+	// the next run sends what is spooled, then the new entries
+	f := newFakeNsqd(t, addr)
+	defer f.ln.Close()
+	l = createNsqLogger(options)
+	defer l.Close()
+	l.Info("three")
+	for _, want := range []string{"INFO one\n", "INFO two\n", "INFO three\n"} {
+		if p := f.next(t); len(p.msgs) != 1 || p.msgs[0] != want {
+			t.Errorf("got %q, want %q", p.msgs, want)
+		}
+	}
+	if fi, err := os.Stat(spool); err != nil || fi.Size() != 0 {
+		t.Errorf("spool not emptied: %v, %v", fi, err)
+	}
+}
+
+// spoolRecord returns a PUB of msg to topic as the spool holds it.
+func spoolRecord(topic, msg string) []byte {
+	cmd := appendNsqPub(nil, topic, append(binary.BigEndian.AppendUint32(nil, uint32(len(msg))), msg...), 1)
+	return append(binary.BigEndian.AppendUint32(nil, uint32(len(cmd))), cmd...)
+}
+
+func TestNsqSpoolRecovery(t *testing.T) {
+	f := newFakeNsqd(t, "127.0.0.1:0")
+	defer f.ln.Close()
+	f.reject = "bad\n"
+	dir := t.TempDir()
+	spool := filepath.Join(dir, program+".nsq")
+	options := map[string]interface{}{
+		"nsqdAddr": f.ln.Addr().String(), "topic": "app", "flag": 0, "spool": dir,
+		"batchSize": 1, "flushInterval": time.Hour, "backoff": time.Hour,
+	}
+
+	// nsqd takes one, fails bad: what went is cut off the spool
+	var data []byte
+	for _, msg := range []string{"one\n", "bad\n", "three\n"} {
+		data = append(data, spoolRecord("app", msg)...)
+	}
+	if err := os.WriteFile(spool, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	errs := make(chan error, 10)
+	options["onError"] = func(err error) { errs <- err }
+	l := createNsqLogger(options)
+	if p := f.next(t); p.msgs[0] != "one\n" {
+		t.Errorf("got %q", p.msgs)
+	}
+	if err := <-errs; !strings.Contains(err.Error(), "E_PUB_FAILED") {
+		t.Errorf("got %v", err)
+	}
+	l.Close()
+	if got, _ := os.ReadFile(spool); string(got) != string(data[len(spoolRecord("app", "one\n")):]) {
+		t.Errorf("spool %q", got)
+	}
+
+	// a record torn by a crash is dropped, and the spool works again
+	f = newFakeNsqd(t, "127.0.0.1:0")
+	defer f.ln.Close()
+	options["nsqdAddr"] = f.ln.Addr().String()
+	torn := append(spoolRecord("app", "two\n"), 0x7f, 0xff, 0xff, 0xff, 'P')
+	if err := os.WriteFile(spool, torn, 0644); err != nil {
+		t.Fatal(err)
+	}
+	l = createNsqLogger(options)
+	if p := f.next(t); p.msgs[0] != "two\n" {
+		t.Errorf("got %q", p.msgs)
+	}
+	if err := <-errs; !strings.Contains(err.Error(), "torn") {
+		t.Errorf("got %v", err)
+	}
+	l.Info("four")
+	if p := f.next(t); p.msgs[0] != "INFO four\n" {
+		t.Errorf("got %q", p.msgs)
+	}
+	l.Close()
+	if fi, err := os.Stat(spool); err != nil || fi.Size() != 0 {
+		t.Errorf("spool not emptied: %v, %v", fi, err)
+	}
+}
@@ -1,5 +1,7 @@
 package glog
 
+import "time"
+
 // 不输出任何日志，仅用于调试时提高性能
 
 type nullLog struct {
@@ -48,6 +50,12 @@ func (c nullLog) Fatal(format string, v ...interface{}) {
 func (c nullLog) Panic(format string, v ...interface{}) {
 }
 
+func (c nullLog) Logw(lv int, msg string, fields []Field) {
+}
+
+func (c nullLog) logpc(lv int, pc uintptr, t time.Time, msg string, fields []Field) {
+}
+
 func (c nullLog) Close() {
 }
 
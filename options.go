@@ -0,0 +1,178 @@
+package glog
+
+import (
+	"io"
+	"log"
+	"strings"
+	"time"
+)
+
+// setOptions configures the Logger part shared by the backends built on
+// it. options:
+//
+//	encoding: string, "text" (default), "json", "logfmt" or "binary"
+//	encoder: Encoder, used instead of the one named by encoding
+//	levelEncoding: map[int]string, encoding of single levels, e.g.
+//	               {DebugLevel: "binary"}
+//	multiline: string, how newlines inside a message are written:
+//	           "raw" (default), "prefix", "indent" or "escape"
+//	multilineMarker: string, starts continuation lines in "indent" mode
+//	color: bool, color the level prefixes of the text encoding
+//	sanitize: bool, escape control characters, ANSI escape sequences and
+//	          invalid UTF-8 in messages; newlines are escaped too unless
+//	          a multiline mode other than "raw" is set
+//	maxEntryBytes: int, longest message, longer ones are truncated with
+//	               a "…[truncated N bytes]" marker
+//	maxFieldBytes: int, longest formatted argument, truncated the same way
+//	redactFields: []string, mask the values of fields whose name contains
+//	              one of these, and of such name=value pairs in messages
+//	redactPatterns: []string, regular expressions of values to mask, such
+//	                as RedactEmail, RedactCreditCard or RedactBearer
+//	redactMask: string, what secrets are replaced with, "[REDACTED]"
+//	processFields: []string, built-in fields the structured encodings
+//	               (json, logfmt and binary) add to every entry: "program",
+//	               "host", "user", "pid", and from the build information
+//	               "module", "version", "revision" and "go"
+//	staticFields: []Field, more fields for every entry, such as
+//	              String("service", "api") or String("env", "prod")
+//	level: int, the lowest level written, DebugLevel by default
+//	onError: func(error), called with the errors of writing entries,
+//	         which are dropped otherwise
+//	buffered: bool, collect the output of each file and write it when
+//	          there is bufferSize of it, every flushInterval, on entries
+//	          of flushLevel or above, and on Flush and Close
+//	bufferSize: int, 8192 by default
+//	flushInterval: time.Duration, 2s by default
+//	flushLevel: int, ErrorLevel by default
+//	async: bool, write from a goroutine of its own; Output only encodes
+//	       the entry and queues it. Entries of ErrorLevel and above take
+//	       a lane that is written first and never dropped
+//	queueSize: int, entries queued in each lane, 1024 by default
+//	overflow: string, what happens to an entry when the queue is full:
+//	          "block" (default), "dropNewest", "dropOldest", or
+//	          "dropBelow": drop it if it is below dropLevel, else block
+//	dropLevel: int, WarnLevel by default
+//	dropReportInterval: time.Duration, how often a "glog: N entries
+//	                    dropped" warning is written, 10s by default
+//	templates: bool, add the format of the leveled calls as field
+//	           "template", its TemplateHash as "template_hash" and the
+//	           arguments as "arg0", "arg1" and so on
+func (l *Logger) setOptions(options map[string]interface{}) {
+	fields, _ := options["redactFields"].([]string)
+	patterns, _ := options["redactPatterns"].([]string)
+	mask, ok := options["redactMask"].(string)
+	if !ok {
+		mask = redactedValue
+	}
+	l.redact = newRedactor(fields, patterns, mask)
+
+	te := textEncoder{marker: "\t", redact: l.redact}
+	static := l.staticFields(options)
+
+	if s, ok := options["multiline"].(string); ok {
+		switch strings.ToLower(strings.TrimSpace(s)) {
+		case "raw":
+			te.multiline = multilineRaw
+		case "prefix":
+			te.multiline = multilinePrefix
+		case "indent":
+			te.multiline = multilineIndent
+		case "escape":
+			te.multiline = multilineEscape
+		default:
+			log.Printf("multiline [%s] invalid, must be raw, prefix, indent or escape, set to raw\n", s)
+		}
+	}
+	if s, ok := options["multilineMarker"].(string); ok {
+		te.marker = s
+	}
+	te.color, _ = options["color"].(bool)
+
+	l.enc = te
+	if s, ok := options["encoding"].(string); ok {
+		l.enc = l.namedEncoder(s, te, static)
+	}
+	if enc, ok := options["encoder"].(Encoder); ok {
+		l.enc = enc
+	}
+	if m, ok := options["levelEncoding"].(map[int]string); ok {
+		l.levelEnc = make(map[int]Encoder)
+		for lv, s := range m {
+			l.levelEnc[lv] = l.namedEncoder(s, te, static)
+		}
+	}
+
+	l.sanitize, _ = options["sanitize"].(bool)
+	l.keepNewlines = te.multiline != multilineRaw
+	l.maxEntry, _ = options["maxEntryBytes"].(int)
+	l.maxField, _ = options["maxFieldBytes"].(int)
+	l.templates, _ = options["templates"].(bool)
+	l.onError, _ = options["onError"].(func(error))
+	if lv, ok := options["level"].(int); ok {
+		l.SetLevel(lv)
+	}
+	if buffered, _ := options["buffered"].(bool); buffered && l.sinks == nil {
+		l.setBuffered(options)
+	}
+	if async, _ := options["async"].(bool); async && l.sinks == nil && l.async == nil {
+		l.setAsync(options)
+	}
+}
+
+// setBuffered makes l collect the output of each writer, see the buffered
+// option, and starts the flushRoutine.
+func (l *Logger) setBuffered(options map[string]interface{}) {
+	l.out.buf = make(map[io.WriteCloser][]byte)
+	if l.out.limit, _ = options["bufferSize"].(int); l.out.limit <= 0 {
+		l.out.limit = maxCacheLength
+	}
+	if l.flushInterval, _ = options["flushInterval"].(time.Duration); l.flushInterval <= 0 {
+		l.flushInterval = maxCacheSeconds * time.Second
+	}
+	if lv, ok := options["flushLevel"].(int); ok {
+		l.flushLevel = lv
+	} else {
+		l.flushLevel = ErrorLevel
+	}
+	if l.stop == nil {
+		l.stop = make(chan struct{})
+		go l.flushRoutine(l.stop)
+	}
+}
+
+// namedEncoder returns the encoder for an encoding name, te for text, with
+// the static fields built into the structured ones.
+func (l *Logger) namedEncoder(name string, te textEncoder, static []Field) Encoder {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "text":
+	case "json":
+		o := jsonObject{n: 1, redact: l.redact}
+		for _, f := range static {
+			o.add(f)
+		}
+		return jsonEncoder{l.redact, o.buf}
+	case "logfmt":
+		return logfmtEncoder{l.redact, appendTextFields(nil, static, l.redact)}
+	case "binary":
+		be := binaryEncoder{redact: l.redact, nstatic: len(static)}
+		for i := range static {
+			be.static = be.appendField(be.static, &static[i])
+		}
+		return be
+	default:
+		log.Printf("encoding [%s] invalid, must be text, json, logfmt or binary, set to text\n", name)
+	}
+	return te
+}
+
+// withoutOptions returns a copy of options without the keys.
+func withoutOptions(options map[string]interface{}, keys ...string) map[string]interface{} {
+	o := make(map[string]interface{}, len(options))
+	for k, v := range options {
+		o[k] = v
+	}
+	for _, k := range keys {
+		delete(o, k)
+	}
+	return o
+}
@@ -0,0 +1,175 @@
+package glog
+
+import (
+	"log"
+	"regexp"
+	"strings"
+)
+
+// Patterns for secrets and personal data, to be used in the
+// redactPatterns option.
+const (
+	RedactEmail      = `[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}`
+	RedactCreditCard = `\b\d(?:[ \-]?\d){12,18}\b`
+	RedactBearer     = `(?i)\bbearer\s+[A-Za-z0-9\-._~+/]+=*`
+)
+
+// redactor masks secrets before an entry is encoded. Field names match
+// keys containing them, case insensitive; in messages they match
+// "name=value" and "name: value" pairs, where the value runs up to the
+// next white space or is quoted.
+//
+// Running regular expressions over every entry is expensive, so each rule
+// has a cheap test that rejects text which cannot match.
+type redactor struct {
+	mask     string
+	fields   []string // lower case field names
+	named    *regexp.Regexp
+	patterns []redactPattern
+}
+
+type redactPattern struct {
+	re   *regexp.Regexp
+	hint func(s string) bool // nil means always try re
+}
+
+// hints for the predefined patterns
+var redactHints = map[string]func(s string) bool{
+	RedactEmail: func(s string) bool {
+		return strings.IndexByte(s, '@') >= 0
+	},
+	RedactCreditCard: func(s string) bool {
+		n := 0
+		for i := 0; i < len(s); i++ {
+			if s[i] >= '0' && s[i] <= '9' {
+				if n++; n >= 13 {
+					return true
+				}
+			}
+		}
+		return false
+	},
+	RedactBearer: func(s string) bool {
+		return indexFold(s, "bearer") >= 0
+	},
+}
+
+func newRedactor(fields, patterns []string, mask string) *redactor {
+	r := &redactor{mask: mask}
+
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			log.Printf("redact pattern [%s] invalid: %v, ignored\n", p, err)
+			continue
+		}
+		r.patterns = append(r.patterns, redactPattern{re, redactHints[p]})
+	}
+
+	var names []string
+	for _, f := range fields {
+		if f = strings.ToLower(strings.TrimSpace(f)); f != "" {
+			r.fields = append(r.fields, f)
+			names = append(names, regexp.QuoteMeta(f))
+		}
+	}
+	if len(names) > 0 {
+		r.named = regexp.MustCompile(`(?i)(\b\w*(?:` + strings.Join(names, "|") +
+			`)\w*["']?\s*[:=]\s*)("[^"]*"|'[^']*'|[^\s,;&]+)`)
+	}
+
+	if len(r.patterns) == 0 && r.named == nil {
+		return nil
+	}
+	return r
+}
+
+// field reports whether the value of the field named key is a secret.
+func (r *redactor) field(key string) bool {
+	for _, f := range r.fields {
+		if indexFold(key, f) >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// nested masks a field found inside an object or array. r may be nil.
+func (r *redactor) nested(f Field) Field {
+	if r == nil {
+		return f
+	}
+	if f.Key != "" && r.field(f.Key) {
+		return String(f.Key, r.mask)
+	}
+	if f.typ == stringType {
+		if s, ok := r.redact(f.str); ok {
+			return String(f.Key, s)
+		}
+	}
+	return f
+}
+
+// redact returns s with every secret masked, and whether there was any.
+func (r *redactor) redact(s string) (string, bool) {
+	found := false
+	for _, p := range r.patterns {
+		if (p.hint == nil || p.hint(s)) && p.re.MatchString(s) {
+			s = p.re.ReplaceAllLiteralString(s, r.mask)
+			found = true
+		}
+	}
+	if r.named != nil && r.hasNamedPair(s) && r.named.MatchString(s) {
+		s = r.named.ReplaceAllString(s, "${1}"+strings.Replace(r.mask, "$", "$$", -1))
+		found = true
+	}
+	return s, found
+}
+
+// hasNamedPair reports whether a word naming a secret field comes before
+// any '=' or ':' in s.
+func (r *redactor) hasNamedPair(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] != '=' && s[i] != ':' {
+			continue
+		}
+		end := i
+		for end > 0 && (s[end-1] == ' ' || s[end-1] == '\t' || s[end-1] == '"' || s[end-1] == '\'') {
+			end--
+		}
+		start := end
+		for start > 0 && isWordByte(s[start-1]) {
+			start--
+		}
+		if start < end && r.field(s[start:end]) {
+			return true
+		}
+	}
+	return false
+}
+
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_'
+}
+
+// indexFold is strings.Index for an ASCII lower case substr, ignoring
+// the case of s.
+func indexFold(s, substr string) int {
+	n := len(substr)
+	for i := 0; i+n <= len(s); i++ {
+		j := 0
+		for ; j < n; j++ {
+			c := s[i+j]
+			if c >= 'A' && c <= 'Z' {
+				c += 'a' - 'A'
+			}
+			if c != substr[j] {
+				break
+			}
+		}
+		if j == n {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,228 @@
+package glog
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Ring keeps the most recent entries of each level in memory, for
+// grabbing the logs of a process whose files are lost. Pass it to a
+// Logger with the typ "ring" and serve it on a debug endpoint:
+//
+//	ring := glog.NewRing(1000, 0)
+//	glog.InitLogger(glog.PRO, map[string]interface{}{"typ": "ring", "ring": ring})
+//	http.Handle("/debug/logs", ring)
+//
+// Entries are kept as encoded by the Logger, time stamped when written.
+type Ring struct {
+	mu         sync.Mutex
+	levels     [LevelCount]ringLevel
+	maxEntries int
+	maxBytes   int
+}
+
+// A RingEntry is an entry kept by a Ring.
+type RingEntry struct {
+	Time  time.Time
+	Level int
+	Text  string // the encoded entry
+}
+
+// A RingQuery selects entries of a Ring. The zero value selects all.
+type RingQuery struct {
+	MinLevel int       // entries of this level and above
+	Since    time.Time // entries written at or after Since, if not zero
+	Until    time.Time // entries written before Until, if not zero
+	Contains string    // entries containing this text
+	Limit    int       // the last Limit entries that match, if not zero
+}
+
+// ringLevel is a circular buffer of the entries of one level.
+type ringLevel struct {
+	items  []RingEntry
+	head   int // index of the oldest entry
+	n      int
+	nbytes int
+}
+
+// NewRing returns a Ring keeping at most maxEntries entries and, if
+// maxBytes is not zero, at most maxBytes bytes of them per level.
+func NewRing(maxEntries, maxBytes int) *Ring {
+	if maxEntries <= 0 {
+		maxEntries = 1000
+	}
+	return &Ring{maxEntries: maxEntries, maxBytes: maxBytes}
+}
+
+func (r *Ring) add(lv int, text string) {
+	if lv < 0 || lv >= LevelCount {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rl := &r.levels[lv]
+	if rl.items == nil {
+		rl.items = make([]RingEntry, r.maxEntries)
+	}
+	for rl.n > 0 && (rl.n == len(rl.items) || r.maxBytes > 0 && rl.nbytes+len(text) > r.maxBytes) {
+		rl.nbytes -= len(rl.items[rl.head].Text)
+		rl.items[rl.head] = RingEntry{}
+		rl.head = (rl.head + 1) % len(rl.items)
+		rl.n--
+	}
+	rl.items[(rl.head+rl.n)%len(rl.items)] = RingEntry{time.Now(), lv, text}
+	rl.n++
+	rl.nbytes += len(text)
+}
+
+// Query returns the entries q selects, oldest first.
+func (r *Ring) Query(q RingQuery) []RingEntry {
+	var res []RingEntry
+	r.mu.Lock()
+	for lv := q.MinLevel; lv < LevelCount; lv++ {
+		if lv < 0 {
+			continue
+		}
+		rl := &r.levels[lv]
+		for i := 0; i < rl.n; i++ {
+			e := rl.items[(rl.head+i)%len(rl.items)]
+			if !q.Since.IsZero() && e.Time.Before(q.Since) ||
+				!q.Until.IsZero() && !e.Time.Before(q.Until) ||
+				q.Contains != "" && !strings.Contains(e.Text, q.Contains) {
+				continue
+			}
+			res = append(res, e)
+		}
+	}
+	r.mu.Unlock()
+
+	sort.SliceStable(res, func(i, j int) bool { return res[i].Time.Before(res[j].Time) })
+	if q.Limit > 0 && len(res) > q.Limit {
+		res = res[len(res)-q.Limit:]
+	}
+	return res
+}
+
+// ServeHTTP writes the entries selected by the query parameters, oldest
+// first:
+//
+//	level: the lowest level, a name such as WARN or a number
+//	since, until: a time in RFC 3339 format, or a duration such as 5m
+//	              meaning that long ago
+//	q: text the entries contain
+//	limit: the number of entries, the most recent ones
+func (r *Ring) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var (
+		q   RingQuery
+		err error
+	)
+	p := req.URL.Query()
+	if s := p.Get("level"); s != "" {
+		if q.MinLevel, err = parseLevel(s); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	now := time.Now()
+	if q.Since, err = parseSince(p.Get("since"), now); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if q.Until, err = parseSince(p.Get("until"), now); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q.Contains = p.Get("q")
+	if s := p.Get("limit"); s != "" {
+		if q.Limit, err = strconv.Atoi(s); err != nil {
+			http.Error(w, "invalid limit "+s, http.StatusBadRequest)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, e := range r.Query(q) {
+		io.WriteString(w, e.Text)
+	}
+}
+
+// parseLevel parses a level name, as used for the level files, or number.
+func parseLevel(s string) (int, error) {
+	for lv, name := range prefixFn {
+		if strings.EqualFold(s, name) {
+			return lv, nil
+		}
+	}
+	lv, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid level %s", s)
+	}
+	return lv, nil
+}
+
+// parseSince parses a time or a duration before now; "" is the zero time.
+func parseSince(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// ringWriter is the writer of one level of a ring Logger.
+type ringWriter struct {
+	r  *Ring
+	lv int
+}
+
+func (w ringWriter) Write(p []byte) (int, error) {
+	w.r.add(w.lv, string(p))
+	return len(p), nil
+}
+
+func (w ringWriter) Close() error { return nil }
+
+// createRingLogger returns a Logger keeping its entries in a Ring.
+//
+// options:
+//
+//	flag: int
+//	prefix: map[int]string
+//	ring: *Ring, where the entries go, see NewRing
+//	ringEntries: int, without ring, the entries kept per level, 1000
+//	ringBytes: int, without ring, the bytes kept per level, no limit
+//	and the Logger options, see setOptions, but buffered: every entry is
+//	stored on its own
+func createRingLogger(options map[string]interface{}) *Logger {
+	flag, ok := options["flag"].(int)
+	if !ok {
+		flag = LstdFlags
+	}
+	prefix, ok := options["prefix"].(map[int]string)
+	if !ok {
+		prefix = prefixFn
+	}
+	r, ok := options["ring"].(*Ring)
+	if !ok {
+		entries, _ := options["ringEntries"].(int)
+		nbytes, _ := options["ringBytes"].(int)
+		r = NewRing(entries, nbytes)
+	}
+
+	l := &Logger{flag: int32(flag)}
+	l.prefix.Store(prefix)
+	l.out.out = make(map[int]io.WriteCloser)
+	for i := DebugLevel; i < LevelCount; i++ {
+		l.out.out[i] = ringWriter{r, i}
+	}
+	l.setOptions(withoutOptions(options, "buffered"))
+	return l
+}
@@ -0,0 +1,60 @@
+package glog
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRing(t *testing.T) {
+	ring := NewRing(3, 21)
+	l := createRingLogger(map[string]interface{}{"flag": 0, "ring": ring})
+	for _, s := range []string{"a", "b", "c", "d"} {
+		l.Info(s)
+	}
+	l.Warn("warning one")
+	l.Warn("warning two") // the bytes limit drops the first
+
+	texts := func(es []RingEntry) (s string) {
+		for _, e := range es {
+			s += e.Text
+		}
+		return s
+	}
+	if got := texts(ring.Query(RingQuery{})); got != "INFO b\nINFO c\nINFO d\nWARN warning two\n" {
+		t.Errorf("all: got %q", got)
+	}
+	if got := texts(ring.Query(RingQuery{MinLevel: WarnLevel})); got != "WARN warning two\n" {
+		t.Errorf("level: got %q", got)
+	}
+	if got := texts(ring.Query(RingQuery{Contains: "c", Limit: 1})); got != "INFO c\n" {
+		t.Errorf("contains: got %q", got)
+	}
+	if got := ring.Query(RingQuery{Since: time.Now().Add(time.Minute)}); len(got) != 0 {
+		t.Errorf("since: got %v", got)
+	}
+
+	rec := httptest.NewRecorder()
+	ring.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/logs?level=info&since=1m&limit=2", nil))
+	if body, _ := io.ReadAll(rec.Body); string(body) != "INFO d\nWARN warning two\n" {
+		t.Errorf("http: got %q", body)
+	}
+	rec = httptest.NewRecorder()
+	ring.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/logs?level=loud", nil))
+	if rec.Code != 400 {
+		t.Errorf("http: got status %d for an invalid level", rec.Code)
+	}
+}
+
+func TestRingBuffered(t *testing.T) {
+	// buffered, inherited from a tee say, does not merge entries
+	ring := NewRing(0, 0)
+	l := createRingLogger(map[string]interface{}{"flag": 0, "ring": ring, "buffered": true})
+	defer l.Close()
+	l.Info("a")
+	l.Info("b")
+	if got := ring.Query(RingQuery{Limit: 1}); len(got) != 1 || got[0].Text != "INFO b\n" {
+		t.Errorf("got %v", got)
+	}
+}
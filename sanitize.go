@@ -0,0 +1,72 @@
+package glog
+
+import (
+	"unicode/utf8"
+)
+
+const hexDigits = "0123456789abcdef"
+
+// needsSanitize reports whether appendSanitized would change s.
+func needsSanitize(s string, keepNewlines bool) bool {
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			if c < ' ' && c != '\t' && !(c == '\n' && keepNewlines) || c == 0x7f {
+				return true
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 || isUnsafeRune(r) {
+			return true
+		}
+		i += size
+	}
+	return false
+}
+
+// appendSanitized appends s to dst so that it can neither forge log lines
+// nor drive a terminal: control characters (including the C1 range, which
+// holds the single byte CSI) are escaped as \n, \r, \xhh or \uhhhh,
+// invalid UTF-8 is replaced by U+FFFD. Tabs are kept, and so are newlines
+// if keepNewlines is set.
+func appendSanitized(dst []byte, s string, keepNewlines bool) []byte {
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '\n' && !keepNewlines:
+				dst = append(dst, '\\', 'n')
+			case c == '\r':
+				dst = append(dst, '\\', 'r')
+			case c < ' ' && c != '\t' && c != '\n' || c == 0x7f:
+				dst = append(dst, '\\', 'x', hexDigits[c>>4], hexDigits[c&0xf])
+			default:
+				dst = append(dst, c)
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		switch {
+		case r == utf8.RuneError && size == 1:
+			dst = append(dst, "�"...)
+		case isUnsafeRune(r):
+			dst = append(dst, '\\', 'u',
+				hexDigits[r>>12&0xf], hexDigits[r>>8&0xf], hexDigits[r>>4&0xf], hexDigits[r&0xf])
+		default:
+			dst = append(dst, s[i:i+size]...)
+		}
+		i += size
+	}
+	return dst
+}
+
+// isUnsafeRune reports C1 controls and the bidirectional overrides that
+// can make a line display differently from what it contains.
+func isUnsafeRune(r rune) bool {
+	return r >= 0x80 && r <= 0x9f ||
+		r >= 0x202a && r <= 0x202e ||
+		r >= 0x2066 && r <= 0x2069
+}
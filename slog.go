@@ -0,0 +1,355 @@
+package glog
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"math"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SlogHandler is a slog.Handler writing to the standard logger of glog,
+// so that slog output goes to the level files like the rest. slog levels
+// map to the glog level at or below them: LevelDebug to DebugLevel and so
+// on, anything from LevelError up to ErrorLevel. The caller and time of
+// the slog record are kept.
+type SlogHandler struct {
+	attrs   []slog.Attr   // WithAttrs outside of any group
+	groups  []string      // the open groups
+	grouped [][]slog.Attr // WithAttrs inside each open group
+}
+
+// NewSlogHandler returns a handler writing to the standard logger, use it
+// with slog.New.
+func NewSlogHandler() *SlogHandler {
+	return &SlogHandler{}
+}
+
+func (h *SlogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return glogLevel(level) >= Level()
+}
+
+func (h *SlogHandler) Handle(_ context.Context, r slog.Record) error {
+	attrs := make([]slog.Attr, 0, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	// close the groups from the innermost, empty ones are left out
+	for i := len(h.groups) - 1; i >= 0; i-- {
+		attrs = append(h.grouped[i][:len(h.grouped[i]):len(h.grouped[i])], attrs...)
+		if len(attrs) > 0 {
+			attrs = []slog.Attr{{Key: h.groups[i], Value: slog.GroupValue(attrs...)}}
+		}
+	}
+
+	var fields []Field
+	for _, a := range h.attrs {
+		fields = appendAttrField(fields, a)
+	}
+	for _, a := range attrs {
+		fields = appendAttrField(fields, a)
+	}
+	_logger.logpc(glogLevel(r.Level), r.PC, r.Time, r.Message, fields)
+	return nil
+}
+
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	h2 := *h
+	if n := len(h.groups); n > 0 {
+		h2.grouped = append(h.grouped[:n-1:n-1], concatAttrs(h.grouped[n-1], attrs))
+	} else {
+		h2.attrs = concatAttrs(h.attrs, attrs)
+	}
+	return &h2
+}
+
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.groups = append(h.groups[:len(h.groups):len(h.groups)], name)
+	h2.grouped = append(h.grouped[:len(h.grouped):len(h.grouped)], nil)
+	return &h2
+}
+
+func concatAttrs(a, b []slog.Attr) []slog.Attr {
+	return append(a[:len(a):len(a)], b...)
+}
+
+// glogLevel maps a slog level to the glog level at or below it.
+func glogLevel(level slog.Level) int {
+	switch {
+	case level < slog.LevelInfo:
+		return DebugLevel
+	case level < slog.LevelWarn:
+		return InfoLevel
+	case level < slog.LevelError:
+		return WarnLevel
+	}
+	return ErrorLevel
+}
+
+// slogLevel maps a glog level to a slog level.
+func slogLevel(lv int) slog.Level {
+	switch lv {
+	case DebugLevel:
+		return slog.LevelDebug
+	case InfoLevel:
+		return slog.LevelInfo
+	case WarnLevel:
+		return slog.LevelWarn
+	}
+	// FATAL and PANIC above ERROR, as slog has no names for them
+	return slog.LevelError + slog.Level(4*(lv-ErrorLevel))
+}
+
+// appendAttrField appends a as a field; groups become objects, or their
+// attributes if the key is empty.
+func appendAttrField(fields []Field, a slog.Attr) []Field {
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		attrs := v.Group()
+		if len(attrs) == 0 {
+			return fields
+		}
+		if a.Key == "" {
+			for _, ga := range attrs {
+				fields = appendAttrField(fields, ga)
+			}
+			return fields
+		}
+		return append(fields, Object(a.Key, attrObject(attrs)))
+	}
+	if a.Key == "" {
+		return fields
+	}
+	return append(fields, valueField(a.Key, v))
+}
+
+func valueField(key string, v slog.Value) Field {
+	switch v.Kind() {
+	case slog.KindString:
+		return String(key, v.String())
+	case slog.KindInt64:
+		return Int64(key, v.Int64())
+	case slog.KindUint64:
+		if u := v.Uint64(); u <= math.MaxInt64 {
+			return Int64(key, int64(u))
+		}
+	case slog.KindFloat64:
+		return Float64(key, v.Float64())
+	case slog.KindBool:
+		return Bool(key, v.Bool())
+	case slog.KindDuration:
+		return Duration(key, v.Duration())
+	case slog.KindTime:
+		return Time(key, v.Time())
+	}
+	if err, ok := v.Any().(error); ok {
+		f := Err(err)
+		f.Key = key
+		return f
+	}
+	return Any(key, v.Any())
+}
+
+// attrObject logs the attributes of a slog group as an object.
+type attrObject []slog.Attr
+
+func (o attrObject) MarshalLogObject(enc ObjectEncoder) error {
+	for _, a := range o {
+		v := a.Value.Resolve()
+		switch v.Kind() {
+		case slog.KindGroup:
+			if a.Key == "" {
+				attrObject(v.Group()).MarshalLogObject(enc)
+			} else if len(v.Group()) > 0 {
+				enc.AddObject(a.Key, attrObject(v.Group()))
+			}
+			continue
+		case slog.KindString:
+			enc.AddString(a.Key, v.String())
+		case slog.KindInt64:
+			enc.AddInt64(a.Key, v.Int64())
+		case slog.KindFloat64:
+			enc.AddFloat64(a.Key, v.Float64())
+		case slog.KindBool:
+			enc.AddBool(a.Key, v.Bool())
+		case slog.KindDuration:
+			enc.AddDuration(a.Key, v.Duration())
+		case slog.KindTime:
+			enc.AddTime(a.Key, v.Time())
+		default:
+			if err, ok := v.Any().(error); ok {
+				enc.AddString(a.Key, err.Error())
+			} else {
+				enc.AddAny(a.Key, v.Any())
+			}
+		}
+	}
+	return nil
+}
+
+// slogLogger is a backend writing to a slog.Handler.
+type slogLogger struct {
+	h      slog.Handler
+	mu     sync.Mutex
+	prefix atomic.Value // map[int]string, only kept for GetPrefix
+	flag   int32
+	level  int32
+}
+
+// createSlogLogger returns a backend handing the entries to a slog.Handler
+// as records with the caller, the message and the fields as attributes.
+// Flags and prefixes are the handler's business; they are only kept.
+//
+// options:
+//
+//	handler: slog.Handler, required; not a SlogHandler, which writes to
+//	         glog
+//	level: int, the lowest level written
+func createSlogLogger(options map[string]interface{}) *slogLogger {
+	h, _ := options["handler"].(slog.Handler)
+	if _, ok := h.(*SlogHandler); ok || h == nil {
+		log.Printf("slog handler [%T] invalid, must not write to glog, set to a text handler on stderr\n", h)
+		h = slog.NewTextHandler(os.Stderr, nil)
+	}
+	prefix, ok := options["prefix"].(map[int]string)
+	if !ok {
+		prefix = prefixFn
+	}
+	s := &slogLogger{h: h}
+	s.prefix.Store(prefix)
+	if lv, ok := options["level"].(int); ok {
+		s.level = int32(lv)
+	}
+	return s
+}
+
+func (s *slogLogger) GetPrefix() map[int]string { return s.prefix.Load().(map[int]string) }
+func (s *slogLogger) Prefix(lv int) string      { return s.GetPrefix()[lv] }
+func (s *slogLogger) Flags() int                { return int(atomic.LoadInt32(&s.flag)) }
+func (s *slogLogger) SetFlags(flag int)         { atomic.StoreInt32(&s.flag, int32(flag)) }
+func (s *slogLogger) Level() int                { return int(atomic.LoadInt32(&s.level)) }
+func (s *slogLogger) SetLevel(level int)        { atomic.StoreInt32(&s.level, int32(level)) }
+func (s *slogLogger) Close()                    {}
+func (s *slogLogger) Flush()                    {}
+
+// SetPrefix replaces the prefix map rather than writing to it, the map
+// may be shared.
+func (s *slogLogger) SetPrefix(lv int, prefix string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.GetPrefix()
+	m := make(map[int]string, len(old)+1)
+	for k, v := range old {
+		m[k] = v
+	}
+	m[lv] = prefix
+	s.prefix.Store(m)
+}
+
+func (s *slogLogger) Debug(format string, v ...interface{}) {
+	s.log(DebugLevel, fmt.Sprintf(format, v...), nil)
+}
+
+func (s *slogLogger) Info(format string, v ...interface{}) {
+	s.log(InfoLevel, fmt.Sprintf(format, v...), nil)
+}
+
+func (s *slogLogger) Warn(format string, v ...interface{}) {
+	s.log(WarnLevel, fmt.Sprintf(format, v...), nil)
+}
+
+func (s *slogLogger) Error(format string, v ...interface{}) {
+	s.log(ErrorLevel, fmt.Sprintf(format, v...), nil)
+}
+
+// Fatal is Error at FatalLevel followed by a call to os.Exit(1).
+func (s *slogLogger) Fatal(format string, v ...interface{}) {
+	s.log(FatalLevel, fmt.Sprintf(format, v...), nil)
+	os.Exit(1)
+}
+
+// Panic is Error at PanicLevel followed by a call to panic.
+func (s *slogLogger) Panic(format string, v ...interface{}) {
+	msg := fmt.Sprintf(format, v...)
+	s.log(PanicLevel, msg, nil)
+	panic(msg)
+}
+
+func (s *slogLogger) Logw(lv int, msg string, fields []Field) {
+	s.log(lv, msg, fields)
+}
+
+// log is called by the methods called by the package functions, the
+// caller three frames up is the user's.
+func (s *slogLogger) log(lv int, msg string, fields []Field) {
+	var pcs [1]uintptr
+	runtime.Callers(4, pcs[:])
+	s.logpc(lv, pcs[0], time.Now(), msg, fields)
+}
+
+func (s *slogLogger) logpc(lv int, pc uintptr, t time.Time, msg string, fields []Field) {
+	level := slogLevel(lv)
+	if lv < s.Level() || !s.h.Enabled(context.Background(), level) {
+		return
+	}
+	r := slog.NewRecord(t, level, msg, pc)
+	for _, f := range fields {
+		r.AddAttrs(fieldAttr(f))
+	}
+	s.h.Handle(context.Background(), r)
+}
+
+// fieldAttr converts a field to a slog attribute; objects become groups.
+func fieldAttr(f Field) slog.Attr {
+	switch f.typ {
+	case stringType:
+		return slog.String(f.Key, f.str)
+	case int64Type:
+		return slog.Int64(f.Key, f.num)
+	case float64Type:
+		return slog.Float64(f.Key, math.Float64frombits(uint64(f.num)))
+	case boolType:
+		return slog.Bool(f.Key, f.num != 0)
+	case durationType:
+		return slog.Duration(f.Key, time.Duration(f.num))
+	case timeType:
+		return slog.Time(f.Key, f.time())
+	case objectType:
+		c := &attrCollector{}
+		if err := f.iface.(ObjectMarshaler).MarshalLogObject(addMethods{c}); err != nil {
+			c.add(String(f.Key+"Error", err.Error()))
+		}
+		return slog.Attr{Key: f.Key, Value: slog.GroupValue(c.attrs...)}
+	case arrayType:
+		c := &attrCollector{}
+		f.iface.(ArrayMarshaler).MarshalLogArray(addMethods{c})
+		vals := make([]interface{}, len(c.attrs))
+		for i, a := range c.attrs {
+			vals[i] = a.Value.Any()
+		}
+		return slog.Any(f.Key, vals)
+	}
+	return slog.Any(f.Key, f.iface)
+}
+
+// attrCollector receives the fields of an object or array as attributes.
+type attrCollector struct {
+	attrs []slog.Attr
+}
+
+func (c *attrCollector) add(f Field) {
+	c.attrs = append(c.attrs, fieldAttr(f))
+}
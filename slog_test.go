@@ -0,0 +1,105 @@
+package glog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestSlogHandler(t *testing.T) {
+	var w bytes.Buffer
+	saved := _logger
+	defer func() { _logger = saved }()
+	_logger = newTestLogger(&w, Lshortfile)
+	SetLevel(InfoLevel)
+
+	sl := slog.New(NewSlogHandler()).With("app", "x").WithGroup("req").With("id", 7)
+	sl.Debug("dropped")
+	_, _, line, _ := runtime.Caller(0)
+	sl.Info("hi", "user", "bob", slog.Group("geo", "lat", 1.5), "err", errors.New("boom"))
+	sl.Log(context.Background(), slog.LevelError+2, "bad")
+	slog.New(NewSlogHandler()).WithGroup("empty").Warn("w")
+
+	want := fmt.Sprintf("slog_test.go:%d: INFO hi app=x req.id=7 req.user=bob req.geo.lat=1.5 req.err=boom\n", line+1) +
+		fmt.Sprintf("slog_test.go:%d: ERROR bad app=x req.id=7\n", line+2) +
+		fmt.Sprintf("slog_test.go:%d: WARN w\n", line+3)
+	if w.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", w.String(), want)
+	}
+}
+
+func TestSlogBackend(t *testing.T) {
+	var w bytes.Buffer
+	h := slog.NewTextHandler(&w, &slog.HandlerOptions{
+		AddSource: true,
+		Level:     slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			if a.Key == slog.SourceKey {
+				src := a.Value.Any().(*slog.Source)
+				return slog.String("source", fmt.Sprintf("%s:%d", src.File[strings.LastIndex(src.File, "/")+1:], src.Line))
+			}
+			return a
+		},
+	})
+	saved := _logger
+	defer func() { _logger = saved }()
+	_logger = createSlogLogger(map[string]interface{}{"handler": h, "level": InfoLevel})
+
+	Debug("dropped")
+	_, _, line, _ := runtime.Caller(0)
+	Info("n=%d", 1)
+	Warnw("hi", String("user", "bob"), Object("req", testObject{}))
+	want := fmt.Sprintf("level=INFO source=slog_test.go:%d msg=\"n=1\"\n", line+1) +
+		fmt.Sprintf("level=WARN source=slog_test.go:%d msg=hi user=bob req.id=7 req.tags=\"[a b]\"\n", line+2)
+	if w.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", w.String(), want)
+	}
+}
+
+type testObject struct{}
+
+func (testObject) MarshalLogObject(enc ObjectEncoder) error {
+	enc.AddInt64("id", 7)
+	enc.AddArray("tags", testArray{"a", "b"})
+	return nil
+}
+
+type testArray []string
+
+func (a testArray) MarshalLogArray(enc ArrayEncoder) error {
+	for _, s := range a {
+		enc.AppendString(s)
+	}
+	return nil
+}
+
+func TestSlogBackendLoop(t *testing.T) {
+	// a handler writing back to glog is refused, not recursed into
+	for _, h := range []interface{}{nil, NewSlogHandler(), NewSlogHandler().WithAttrs([]slog.Attr{slog.Int("n", 1)})} {
+		s := createSlogLogger(map[string]interface{}{"handler": h})
+		if _, ok := s.h.(*slog.TextHandler); !ok {
+			t.Errorf("%T: got handler %T", h, s.h)
+		}
+	}
+}
+
+func TestSlogBackendPrefix(t *testing.T) {
+	s := createSlogLogger(map[string]interface{}{"handler": slog.NewTextHandler(io.Discard, nil)})
+	name := levelName(InfoLevel)
+	s.SetPrefix(InfoLevel, "information:")
+	if got := s.Prefix(InfoLevel); got != "information:" {
+		t.Errorf("got prefix %q", got)
+	}
+	if got := levelName(InfoLevel); got != name {
+		t.Errorf("got level name %q, want %q", got, name)
+	}
+}
@@ -0,0 +1,70 @@
+package glog
+
+import (
+	"log"
+	"runtime/debug"
+)
+
+// staticFields returns the fields the structured encoders put on every
+// entry: the built-in ones named by processFields first, then the
+// staticFields of options. The message policies are applied once here.
+func (l *Logger) staticFields(options map[string]interface{}) []Field {
+	var fields []Field
+	names, _ := options["processFields"].([]string)
+	for _, name := range names {
+		if f, ok := builtinField(name); ok {
+			fields = append(fields, f)
+		} else {
+			log.Printf("process field [%s] unknown, must be program, host, user, pid, module, version, revision or go, ignored\n", name)
+		}
+	}
+	if fs, ok := options["staticFields"].([]Field); ok {
+		fields = append(fields, fs...)
+	}
+
+	b := getBuffer()
+	for i := range fields {
+		fields[i], _ = l.processField(b, fields[i])
+	}
+	putBuffer(b)
+	return fields
+}
+
+// builtinField returns the built-in static field called name.
+func builtinField(name string) (Field, bool) {
+	switch name {
+	case "program":
+		return String(name, program), true
+	case "host":
+		return String(name, host), true
+	case "user":
+		return String(name, userName), true
+	case "pid":
+		return Int(name, pid), true
+	case "module", "version", "revision", "go":
+		return String(name, buildInfo(name)), true
+	}
+	return Field{}, false
+}
+
+// buildInfo looks up name in the build information of the binary.
+func buildInfo(name string) string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	switch name {
+	case "module":
+		return info.Main.Path
+	case "version":
+		return info.Main.Version
+	case "go":
+		return info.GoVersion
+	}
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" {
+			return s.Value
+		}
+	}
+	return "unknown"
+}
@@ -0,0 +1,307 @@
+package glog
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Syslog facilities, for the facility option of the syslog sink.
+const (
+	FacilityKern = iota
+	FacilityUser
+	FacilityMail
+	FacilityDaemon
+	FacilityAuth
+	FacilitySyslog
+	FacilityLPR
+	FacilityNews
+	FacilityUUCP
+	FacilityCron
+	FacilityAuthPriv
+	FacilityFTP
+	FacilityLocal0 = iota + 4
+	FacilityLocal1
+	FacilityLocal2
+	FacilityLocal3
+	FacilityLocal4
+	FacilityLocal5
+	FacilityLocal6
+	FacilityLocal7
+)
+
+var facilityNames = map[string]int{
+	"kern": FacilityKern, "user": FacilityUser, "mail": FacilityMail,
+	"daemon": FacilityDaemon, "auth": FacilityAuth, "syslog": FacilitySyslog,
+	"lpr": FacilityLPR, "news": FacilityNews, "uucp": FacilityUUCP,
+	"cron": FacilityCron, "authpriv": FacilityAuthPriv, "ftp": FacilityFTP,
+	"local0": FacilityLocal0, "local1": FacilityLocal1, "local2": FacilityLocal2,
+	"local3": FacilityLocal3, "local4": FacilityLocal4, "local5": FacilityLocal5,
+	"local6": FacilityLocal6, "local7": FacilityLocal7,
+}
+
+// syslogSeverity maps the glog levels to syslog severities.
+var syslogSeverity = map[int]int{
+	DebugLevel: 7, // debug
+	InfoLevel:  6, // informational
+	WarnLevel:  4, // warning
+	ErrorLevel: 3, // error
+	FatalLevel: 2, // critical
+	PanicLevel: 1, // alert
+}
+
+// syslogEncoder writes syslog messages in the format of RFC 5424:
+//
+//	<134>1 2009-01-23T01:23:23.123123+08:00 host app 1234 - [sd] message
+//
+// or of RFC 3164:
+//
+//	<134>Jan 23 01:23:23 host app[1234]: message
+//
+// Fields go into the structured data element sdID if there is one, else
+// after the message as in the text encoding.
+type syslogEncoder struct {
+	rfc3164  bool
+	facility int
+	hostname string
+	appName  string
+	sd       string // static structured data elements
+	sdID     string
+	redact   *redactor
+}
+
+func (se syslogEncoder) Encode(buf []byte, flag int, e *Entry) []byte {
+	buf = append(buf, '<')
+	buf = strconv.AppendInt(buf, int64(se.facility*8+syslogSeverity[e.Level]), 10)
+	buf = append(buf, '>')
+	if se.rfc3164 {
+		buf = e.Time.AppendFormat(buf, time.Stamp)
+		buf = append(buf, ' ')
+		buf = append(buf, se.hostname...)
+		buf = append(buf, ' ')
+		buf = append(buf, se.appName...)
+		buf = append(buf, '[')
+		buf = strconv.AppendInt(buf, int64(pid), 10)
+		buf = append(buf, "]: "...)
+	} else {
+		buf = append(buf, "1 "...)
+		buf = e.Time.AppendFormat(buf, "2006-01-02T15:04:05.000000Z07:00")
+		buf = append(buf, ' ')
+		buf = append(buf, se.hostname...)
+		buf = append(buf, ' ')
+		buf = append(buf, se.appName...)
+		buf = append(buf, ' ')
+		buf = strconv.AppendInt(buf, int64(pid), 10)
+		buf = append(buf, " - "...)
+		buf = se.appendSD(buf, e)
+		buf = append(buf, ' ')
+	}
+
+	if e.File != "" {
+		buf = append(buf, callerFile(flag, e.File)...)
+		buf = append(buf, ':')
+		buf = strconv.AppendInt(buf, int64(e.Line), 10)
+		buf = append(buf, ": "...)
+	}
+	buf = append(buf, strings.TrimSuffix(e.Message, "\n")...)
+	if se.sdID == "" || se.rfc3164 {
+		buf = appendTextFields(buf, e.Fields, se.redact)
+	}
+	return buf
+}
+
+// appendSD appends the structured data of RFC 5424, "-" if there is none.
+func (se syslogEncoder) appendSD(buf []byte, e *Entry) []byte {
+	fields := se.sdID != "" && len(e.Fields) > 0
+	if se.sd == "" && !fields {
+		return append(buf, '-')
+	}
+	buf = append(buf, se.sd...)
+	if !fields {
+		return buf
+	}
+	buf = append(buf, '[')
+	buf = append(buf, se.sdID...)
+	tmp := getBuffer()
+	for i := range e.Fields {
+		f := &e.Fields[i]
+		buf = append(buf, ' ')
+		buf = appendSDName(buf, f.Key)
+		buf = append(buf, `="`...)
+		tmp.msg = f.appendText(tmp.msg[:0])
+		for _, c := range tmp.msg {
+			if c == '"' || c == '\\' || c == ']' {
+				buf = append(buf, '\\')
+			}
+			buf = append(buf, c)
+		}
+		buf = append(buf, '"')
+	}
+	putBuffer(tmp)
+	return append(buf, ']')
+}
+
+// appendSDName appends a field key as an SD-NAME: printable ASCII but
+// '=', ' ', ']' and '"', at most 32 characters.
+func appendSDName(buf []byte, key string) []byte {
+	if len(key) > 32 {
+		key = key[:32]
+	}
+	if key == "" {
+		return append(buf, '_')
+	}
+	for i := 0; i < len(key); i++ {
+		c := key[i]
+		if c <= ' ' || c >= 0x7f || c == '=' || c == ']' || c == '"' {
+			c = '_'
+		}
+		buf = append(buf, c)
+	}
+	return buf
+}
+
+// syslogWriter sends syslog messages to the local syslog daemon, one
+// datagram per write. It connects on the first write and again after an
+// error. Syslog at an address goes through a netWriter instead.
+type syslogWriter struct {
+	conn net.Conn
+}
+
+// localSyslog are the sockets of the local syslog daemon on various
+// systems.
+var localSyslog = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+func (w *syslogWriter) connect() (err error) {
+	for _, path := range localSyslog {
+		if w.conn, err = net.Dial("unixgram", path); err == nil {
+			return nil
+		}
+	}
+	return errors.New("glog: no local syslog socket found")
+}
+
+func (w *syslogWriter) Write(p []byte) (int, error) {
+	// one retry on a new connection, the daemon may have been restarted
+	var err error
+	for try := 0; try < 2; try++ {
+		if w.conn == nil {
+			if err = w.connect(); err != nil {
+				continue
+			}
+		}
+		if _, err = w.conn.Write(p); err == nil {
+			return len(p), nil
+		}
+		w.conn.Close()
+		w.conn = nil
+	}
+	return 0, err
+}
+
+func (w *syslogWriter) Close() error {
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+// frameOctetCount puts the length of each entry and a space in front of
+// it, the octet counting of RFC 6587.
+func frameOctetCount(dst, p []byte) []byte {
+	dst = strconv.AppendInt(dst, int64(len(p)), 10)
+	dst = append(dst, ' ')
+	return append(dst, p...)
+}
+
+// createSyslogLogger returns a Logger writing to syslog.
+//
+// options:
+//
+//	network: string, "unixgram" (default), "unix", "udp" or "tcp"; with
+//	         "tcp" and "unix" messages are framed by octet counting
+//	addr: string, the socket path or host:port, the local syslog daemon
+//	      if not given
+//	tls, dialTimeout, writeTimeout, backoff, maxBackoff, pendingBytes:
+//	      for an addr, see createNetLogger
+//	format: string, "rfc5424" (default) or "rfc3164"
+//	facility: int or string, FacilityUser or "user" (default) ...
+//	          FacilityLocal7 or "local7"
+//	appName: string, the program name by default
+//	hostname: string, os.Hostname by default
+//	structuredData: string, SD elements for every message, such as
+//	                `[origin@32473 env="prod"]`
+//	sdID: string, the SD-ID of an element with the fields of the entry,
+//	      such as "fields@32473"; without it they follow the message
+//	flag: int, Lshortfile or Llongfile put the caller before the message
+//	and the Logger options, see setOptions, but encoding and buffered:
+//	every message is written on its own
+//
+// Messages to an addr are sent by a goroutine of their own, as those of
+// createNetLogger; those to the local daemon are written directly.
+func createSyslogLogger(options map[string]interface{}) *Logger {
+	se := syslogEncoder{facility: FacilityUser, appName: program}
+	switch f := options["facility"].(type) {
+	case nil:
+	case int:
+		se.facility = f
+	case string:
+		if n, ok := facilityNames[strings.ToLower(f)]; ok {
+			se.facility = n
+		} else {
+			log.Printf("facility [%s] invalid, set to user\n", f)
+		}
+	}
+	if s, ok := options["format"].(string); ok {
+		switch strings.ToLower(s) {
+		case "rfc5424":
+		case "rfc3164":
+			se.rfc3164 = true
+		default:
+			log.Printf("syslog format [%s] invalid, must be rfc5424 or rfc3164, set to rfc5424\n", s)
+		}
+	}
+	if s, ok := options["appName"].(string); ok && s != "" {
+		se.appName = s
+	}
+	se.hostname, _ = options["hostname"].(string)
+	if se.hostname == "" {
+		se.hostname, _ = os.Hostname()
+	}
+	if se.hostname == "" {
+		se.hostname = "-"
+	}
+	se.sd, _ = options["structuredData"].(string)
+	se.sdID, _ = options["sdID"].(string)
+
+	var w io.WriteCloser = &syslogWriter{}
+	if addr, _ := options["addr"].(string); addr != "" {
+		nw := newNetWriter(options)
+		if s, _ := options["network"].(string); s == "" {
+			nw.network = "unixgram"
+		}
+		if nw.stream() {
+			nw.frame = frameOctetCount
+		}
+		w = nw
+	}
+
+	flag, _ := options["flag"].(int)
+	l := &Logger{flag: int32(flag)}
+	l.prefix.Store(prefixFn)
+	l.out.out = make(map[int]io.WriteCloser)
+	for i := DebugLevel; i < LevelCount; i++ {
+		l.out.out[i] = w
+	}
+	l.setOptions(withoutOptions(options, "buffered"))
+	se.redact = l.redact
+	l.enc = se
+	l.levelEnc = nil
+	return l
+}
@@ -0,0 +1,136 @@
+package glog
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyslogEncoder(t *testing.T) {
+	e := &Entry{
+		Level:   WarnLevel,
+		Time:    testTime,
+		Message: "disk full\n",
+		Fields:  []Field{String("dev", `/dev/sda"1]`), Int("pct", 99)},
+	}
+	tests := []struct {
+		se   syslogEncoder
+		want string
+	}{
+		{syslogEncoder{facility: FacilityLocal0, hostname: "h", appName: "app"},
+			`<132>1 2015-09-30T08:00:00.000000Z h app PID - - disk full dev="/dev/sda\"1]" pct=99`},
+		{syslogEncoder{facility: FacilityUser, hostname: "h", appName: "app", sd: `[a@1 x="y"]`, sdID: "f@1"},
+			`<12>1 2015-09-30T08:00:00.000000Z h app PID - [a@1 x="y"][f@1 dev="/dev/sda\"1\]" pct="99"] disk full`},
+		{syslogEncoder{rfc3164: true, facility: FacilityDaemon, hostname: "h", appName: "app"},
+			`<28>Sep 30 08:00:00 h app[PID]: disk full dev="/dev/sda\"1]" pct=99`},
+	}
+	for _, tt := range tests {
+		want := regexp.MustCompile("PID").ReplaceAllString(tt.want, strconv.Itoa(pid))
+		if got := string(tt.se.Encode(nil, 0, e)); got != want {
+			t.Errorf("got  %s\nwant %s", got, want)
+		}
+	}
+}
+
+func TestSyslogWriter(t *testing.T) {
+	// datagrams over a unix socket
+	path := filepath.Join(t.TempDir(), "log")
+	pc, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Skip(err)
+	}
+	defer pc.Close()
+	l := createSyslogLogger(map[string]interface{}{"addr": path, "hostname": "h", "appName": "app"})
+	l.Error("one")
+	buf := make([]byte, 1024)
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil || !regexp.MustCompile(`^<11>1 \S+ h app \d+ - - one$`).Match(buf[:n]) {
+		t.Errorf("unixgram: got %q, %v", buf[:n], err)
+	}
+	l.Close()
+
+	// octet counting over TCP, reconnecting when the server drops us
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer ln.Close()
+	l = createSyslogLogger(map[string]interface{}{
+		"network": "tcp", "addr": ln.Addr().String(), "format": "rfc3164", "facility": "local7",
+		"hostname": "h", "appName": "app",
+	})
+	defer l.Close()
+	readFrame := func(c net.Conn) string {
+		r := bufio.NewReader(c)
+		size, err := r.ReadString(' ')
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, _ := strconv.Atoi(size[:len(size)-1])
+		frame := make([]byte, n)
+		if _, err = io.ReadFull(r, frame); err != nil {
+			t.Fatal(err)
+		}
+		return string(frame)
+	}
+	frameRE := regexp.MustCompile(`^<190>\w{3} [ \d]\d \S+ h app\[\d+\]: (\w+)$`)
+
+	l.Info("first")
+	c, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := frameRE.FindStringSubmatch(readFrame(c)); m == nil || m[1] != "first" {
+		t.Errorf("tcp: got %q", m)
+	}
+	c.Close()
+
+	accepted := make(chan net.Conn)
+	go func() {
+		c, _ := ln.Accept()
+		accepted <- c
+	}()
+	// writes to the dropped connection may still succeed for a while
+	for c = nil; c == nil; {
+		l.Info("second")
+		select {
+		case c = <-accepted:
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	defer c.Close()
+	if m := frameRE.FindStringSubmatch(readFrame(c)); m == nil || m[1] != "second" {
+		t.Errorf("tcp after reconnecting: got %q", m)
+	}
+}
+
+func TestSyslogStalled(t *testing.T) {
+	// a collector that takes the connection and reads nothing
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer ln.Close()
+	conns := accept(ln)
+	l := createSyslogLogger(map[string]interface{}{
+		"network": "tcp", "addr": ln.Addr().String(), "writeTimeout": time.Duration(0),
+	})
+	start := time.Now()
+	big := strings.Repeat("x", 64<<10)
+	for i := 0; i < 200; i++ {
+		l.Info("%s", big)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("logging waited %v for the network", d)
+	}
+	(<-conns).Close()
+	l.Close()
+}
+
+var testTime = time.Date(2015, 9, 30, 8, 0, 0, 0, time.UTC)
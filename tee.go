@@ -0,0 +1,124 @@
+package glog
+
+import "log"
+
+// sinkLogger is a backend that can be a sink of a tee logger: one built
+// on Logger, which provides base.
+type sinkLogger interface {
+	logger
+	base() *Logger
+}
+
+func (l *Logger) base() *Logger {
+	return l
+}
+
+// createTeeLogger returns a Logger that sends every entry to several
+// sinks, each with its own level, encoding and error handling. The entry
+// is formatted once, by the tee; the sinks apply their message policies
+// and encode it.
+//
+// options:
+//
+//	sinks: []map[string]interface{}, the options of each sink, with typ
+//	       "console", "file", "ring", "syslog", "journald", "net", "gelf",
+//	       "fluentd", "nsq" or "http"; what a sink does not set it takes
+//	       from the options of the tee
+//	level: int, by default the lowest level of the sinks
+//	and the Logger options, see setOptions
+//
+// SetFlags and SetPrefix apply to the sinks as well, SetLevel only to the
+// tee: a sink still drops the levels below its own.
+func createTeeLogger(options map[string]interface{}) *Logger {
+	confs, _ := options["sinks"].([]map[string]interface{})
+
+	l := &Logger{}
+	flag, level := 0, LevelCount
+	for _, conf := range confs {
+		o := withoutOptions(options, "typ", "sinks")
+		for k, v := range conf {
+			o[k] = v
+		}
+		s := createSink(o)
+		if s == nil {
+			continue
+		}
+		l.sinks = append(l.sinks, s)
+		flag |= s.Flags()
+		if lv := s.Level(); lv < level {
+			level = lv
+		}
+	}
+	if len(l.sinks) == 0 {
+		log.Printf("tee logger has no valid sinks, writing to the console\n")
+		s := createConsoleLogger(options)
+		l.sinks = append(l.sinks, s)
+		flag, level = s.Flags(), s.Level()
+	}
+
+	l.flag = int32(flag)
+	prefix, ok := options["prefix"].(map[int]string)
+	if !ok {
+		prefix = prefixFn
+	}
+	l.prefix.Store(prefix)
+	l.setOptions(options)
+	if _, ok := options["level"].(int); !ok {
+		l.SetLevel(level)
+	}
+	return l
+}
+
+func createSink(options map[string]interface{}) sinkLogger {
+	typ, _ := options["typ"].(string)
+	switch typ {
+	case "console":
+		return createConsoleLogger(options)
+	case "file":
+		return createFileLogger(options)
+	case "ring":
+		return createRingLogger(options)
+	case "syslog":
+		return createSyslogLogger(options)
+	case "journald":
+		return createJournaldLogger(options)
+	case "net":
+		return createNetLogger(options)
+	case "gelf":
+		return createGelfLogger(options)
+	case "fluentd":
+		return createFluentdLogger(options)
+	case "nsq":
+		return createNsqLogger(options)
+	case "http":
+		return createHTTPLogger(options)
+	}
+	log.Printf("sink typ [%s] invalid, must be console, file, ring, syslog, journald, net, gelf, fluentd, nsq or http, ignored\n", typ)
+	return nil
+}
+
+// fanout hands a copy of the entry to each sink that wants its level.
+// The first error is returned, after all sinks had their turn.
+func (l *Logger) fanout(b *buffer) error {
+	var first error
+	for _, s := range l.sinks {
+		sl := s.base()
+		if b.e.Level < sl.Level() {
+			continue
+		}
+		c := getBuffer()
+		c.e = b.e
+		c.e.Prefix = sl.prefixes()[b.e.Level]
+		c.msg = append(c.msg, b.e.Message...)
+		c.e.Message = c.message()
+		c.fields = append(c.fields, b.e.Fields...)
+		c.e.Fields = c.fields
+		c.args = b.args
+		c.truncated = b.truncated
+		if err := sl.emit(c); err != nil && first == nil {
+			first = err
+		}
+	}
+	putBuffer(b)
+	return first
+}
@@ -0,0 +1,52 @@
+package glog
+
+import (
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// argNames are the keys of the first arguments of a template entry.
+var argNames = [...]string{"arg0", "arg1", "arg2", "arg3", "arg4", "arg5", "arg6", "arg7"}
+
+// TemplateHash returns the hash written as "template_hash" with the
+// templates option: the 64 bit FNV-1a hash of format in hex. It is stable
+// across processes and releases, so it can be used to count the entries
+// of one message.
+func TemplateHash(format string) string {
+	h := fnv.New64a()
+	h.Write([]byte(format))
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+// addTemplate adds the format and the arguments of a leveled call to the
+// fields of the entry.
+func (b *buffer) addTemplate(format string, v []interface{}) {
+	b.e.Template = format
+	b.fields = append(b.fields, String("template", format), String("template_hash", TemplateHash(format)))
+	for i := range v {
+		name := ""
+		if i < len(argNames) {
+			name = argNames[i]
+		} else {
+			name = "arg" + strconv.Itoa(i)
+		}
+		b.fields = append(b.fields, Any(name, v[i]))
+	}
+	b.args = len(v)
+	b.e.Fields = b.fields
+}
+
+// redactArgs masks the arguments that redaction removed from the message,
+// so that a secret does not survive as a field.
+func (l *Logger) redactArgs(b *buffer) {
+	args := b.e.Fields[len(b.e.Fields)-b.args:]
+	tmp := getBuffer()
+	for i := range args {
+		tmp.msg = args[i].appendText(tmp.msg[:0])
+		if len(tmp.msg) > 0 && !strings.Contains(b.e.Message, tmp.message()) {
+			args[i] = String(args[i].Key, l.redact.mask)
+		}
+	}
+	putBuffer(tmp)
+}
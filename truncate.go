@@ -0,0 +1,88 @@
+package glog
+
+import (
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+)
+
+// appendTruncated appends the first max bytes of s, backing off to a rune
+// boundary, and a marker telling how many bytes were dropped.
+func appendTruncated(dst []byte, s string, max int) []byte {
+	cut := max
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	dst = append(dst, s[:cut]...)
+	dst = append(dst, "…[truncated "...)
+	dst = strconv.AppendInt(dst, int64(len(s)-cut), 10)
+	return append(dst, " bytes]"...)
+}
+
+// limitedArg formats its value the way fmt would, cut to the field size
+// limit of the Logger. Secrets are masked before cutting, so that no part
+// of one survives in the truncated text.
+type limitedArg struct {
+	v interface{}
+	l *Logger
+	b *buffer // the entry being formatted, to flag truncation
+}
+
+func (a limitedArg) Format(f fmt.State, verb rune) {
+	tmp := getBuffer()
+	tmp.msg = fmt.Appendf(tmp.msg, fmt.FormatString(f, verb), a.v)
+	if len(tmp.msg) <= a.l.maxField {
+		f.Write(tmp.msg)
+		putBuffer(tmp)
+		return
+	}
+
+	s := tmp.message()
+	if a.l.redact != nil {
+		s, _ = a.l.redact.redact(s)
+	}
+	if len(s) > a.l.maxField {
+		tmp.out = appendTruncated(tmp.out, s, a.l.maxField)
+		a.b.truncated = true
+	} else {
+		tmp.out = append(tmp.out, s...)
+	}
+	f.Write(tmp.out)
+	putBuffer(tmp)
+}
+
+// limitArgs wraps the arguments so that none of them renders longer than
+// the field size limit. fmt answers %T and %p without asking a Formatter,
+// so formats using them are left alone.
+func (l *Logger) limitArgs(b *buffer, format string, v []interface{}) []interface{} {
+	if len(v) == 0 || hasTypeVerb(format) {
+		return v
+	}
+	lv := make([]interface{}, len(v))
+	for i := range v {
+		lv[i] = limitedArg{v[i], l, b}
+	}
+	return lv
+}
+
+// hasTypeVerb reports whether format contains a %T or %p directive.
+func hasTypeVerb(format string) bool {
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		// skip flags, width, precision and argument indexes
+		for i++; i < len(format); i++ {
+			c := format[i]
+			if c == '+' || c == '-' || c == '#' || c == ' ' || c == '0' ||
+				c >= '1' && c <= '9' || c == '.' || c == '*' || c == '[' || c == ']' {
+				continue
+			}
+			if c == 'T' || c == 'p' {
+				return true
+			}
+			break
+		}
+	}
+	return false
+}
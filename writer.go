@@ -0,0 +1,82 @@
+package glog
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"sync"
+	"unicode/utf8"
+)
+
+// maxLine is the most of an incomplete line kept, beyond it the line is
+// logged in parts.
+const maxLine = 64 << 10
+
+// lineWriter turns the lines written to it into entries of the standard
+// logger.
+type lineWriter struct {
+	mu   sync.Mutex
+	lv   int
+	line []byte // an incomplete line, waiting for its end
+}
+
+// NewWriter returns an io.Writer that logs each line written to it as an
+// entry of level lv with the standard logger, for packages that want an
+// io.Writer to log to. An incomplete line is kept until its end arrives,
+// or until it is 64KB long.
+func NewWriter(lv int) io.Writer {
+	return &lineWriter{lv: lv}
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	n := len(p)
+	for len(p) > 0 {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			w.line = append(w.line, p...)
+			for len(w.line) >= maxLine {
+				// cut between runes
+				cut := maxLine
+				for cut > maxLine-utf8.UTFMax && !utf8.RuneStart(w.line[cut]) {
+					cut--
+				}
+				w.log(w.line[:cut])
+				w.line = w.line[:copy(w.line, w.line[cut:])]
+			}
+			break
+		}
+		line := p[:i]
+		if len(w.line) > 0 {
+			w.line = append(w.line, line...)
+			line = w.line
+		}
+		w.log(line)
+		w.line = w.line[:0]
+		p = p[i+1:]
+	}
+	return n, nil
+}
+
+func (w *lineWriter) log(line []byte) {
+	if len(line) > 0 && w.lv >= Level() {
+		_logger.Logw(w.lv, string(line), nil)
+	}
+}
+
+// RedirectStdLog sends the output of the standard log package to glog, as
+// entries of level lv, and turns off its own header. It returns a function
+// that undoes this. The console backend does not write through the
+// standard logger, so this does not loop.
+func RedirectStdLog(lv int) func() {
+	flags, prefix, out := log.Flags(), log.Prefix(), log.Writer()
+	log.SetFlags(0)
+	log.SetPrefix("")
+	log.SetOutput(NewWriter(lv))
+	return func() {
+		log.SetFlags(flags)
+		log.SetPrefix(prefix)
+		log.SetOutput(out)
+	}
+}
@@ -0,0 +1,68 @@
+package glog
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestRedirectStdLog(t *testing.T) {
+	var w bytes.Buffer
+	saved := _logger
+	defer func() { _logger = saved }()
+	_logger = newTestLogger(&w, 0)
+	SetLevel(InfoLevel)
+
+	restore := RedirectStdLog(WarnLevel)
+	log.Printf("from %s", "std")
+	log.Print("two\nlines")
+	restore()
+	if _, ok := log.Writer().(*lineWriter); ok {
+		t.Error("the standard logger still writes to glog")
+	}
+
+	wr := NewWriter(DebugLevel)
+	fmt.Fprint(wr, "dropped, below the level\n")
+
+	wr = NewWriter(ErrorLevel)
+	fmt.Fprint(wr, "part")
+	fmt.Fprint(wr, "ial\n\nrest")
+
+	want := "WARN from std\nWARN two\nWARN lines\nERROR partial\n"
+	if w.String() != want {
+		t.Errorf("got %q, want %q", w.String(), want)
+	}
+}
+
+func TestWriterLongLine(t *testing.T) {
+	var w bytes.Buffer
+	saved := _logger
+	defer func() { _logger = saved }()
+	_logger = newTestLogger(&w, 0)
+
+	// a writer that never ends its line is logged in parts, cut between
+	// runes
+	wr := NewWriter(ErrorLevel).(*lineWriter)
+	long := "a" + strings.Repeat("é", maxLine)
+	for i := 0; i < 4; i++ {
+		fmt.Fprint(wr, long)
+	}
+	if len(wr.line) >= maxLine {
+		t.Errorf("%d bytes kept", len(wr.line))
+	}
+	fmt.Fprint(wr, "\n")
+	got := strings.Split(strings.TrimSuffix(w.String(), "\n"), "\n")
+	var joined strings.Builder
+	for _, line := range got {
+		if !strings.HasPrefix(line, "ERROR ") || !utf8.ValidString(line) || len(line) > maxLine+len("ERROR ") {
+			t.Fatalf("line %.20q... of %d bytes", line, len(line))
+		}
+		joined.WriteString(line[len("ERROR "):])
+	}
+	if joined.String() != strings.Repeat(long, 4) {
+		t.Errorf("lost or changed output, %d lines", len(got))
+	}
+}